@@ -296,6 +296,55 @@ func (h *baseHost) StopContainer(ctx context.Context, name string, timeout *time
 	return nil
 }
 
+func (h *baseHost) PauseContainer(ctx context.Context, name string) error {
+	e := util.StringError("pause container")
+
+	cid, err := h.findContainer(ctx, name)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	if err := h.client.ContainerPause(ctx, cid); err != nil {
+		return e.Wrap(err)
+	}
+
+	return nil
+}
+
+func (h *baseHost) UnpauseContainer(ctx context.Context, name string) error {
+	e := util.StringError("unpause container")
+
+	cid, err := h.findContainer(ctx, name)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	if err := h.client.ContainerUnpause(ctx, cid); err != nil {
+		return e.Wrap(err)
+	}
+
+	return nil
+}
+
+func (h *baseHost) KillContainer(ctx context.Context, name, signal string) error {
+	e := util.StringError("kill container")
+
+	cid, err := h.findContainer(ctx, name)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	if len(signal) < 1 {
+		signal = "SIGKILL"
+	}
+
+	if err := h.client.ContainerKill(ctx, cid, signal); err != nil {
+		return e.Wrap(err)
+	}
+
+	return nil
+}
+
 func (h *baseHost) RemoveContainer(ctx context.Context, name string, options container.RemoveOptions) error {
 	e := util.StringError("remove container")
 
@@ -376,6 +425,15 @@ func (h *baseHost) freePort(
 	}
 }
 
+func (h *baseHost) Port(id string) (string, bool) {
+	h.portsLock.Lock()
+	defer h.portsLock.Unlock()
+
+	p, found := h.ports[id]
+
+	return p, found
+}
+
 func (h *baseHost) addFile(name, path string) {
 	h.files[name] = path
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/contest"
+)
+
+// openContestDB opens the log database of the finished contest in base
+// directory; it runs new FerretDB over the stored sqlite files.
+func openContestDB(basedir string) (*contest.Mongodb, func(), error) {
+	dbdir, err := findContestDBDir(basedir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// NOTE the unix socket path is limited in length
+	sockdir, err := os.MkdirTemp("", "contest-")
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	closef := func() {
+		cancel()
+
+		_ = os.RemoveAll(sockdir)
+	}
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})).
+		With(slog.String("module", "ferretdb"))
+
+	sock := filepath.Join(sockdir, "contest.sock")
+
+	if err := contest.RunFerretDB(ctx, sock, dbdir, logger); err != nil {
+		closef()
+
+		return nil, nil, err //nolint:wrapcheck //...
+	}
+
+	db, err := contest.NewMongodbFromURI(ctx, fmt.Sprintf("mongodb://%s/contest", url.QueryEscape(sock)))
+	if err != nil {
+		closef()
+
+		return nil, nil, err //nolint:wrapcheck //...
+	}
+
+	return db, func() {
+		_ = db.Close(context.Background())
+
+		closef()
+	}, nil
+}
+
+// findContestDBDir finds the directory of sqlite files of log database.
+func findContestDBDir(basedir string) (string, error) {
+	var dbdir string
+
+	if err := filepath.WalkDir(basedir, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir():
+			return nil
+		case d.Name() == "contest.sqlite":
+			dbdir = filepath.Dir(path)
+
+			return filepath.SkipAll
+		default:
+			return nil
+		}
+	}); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if len(dbdir) < 1 {
+		return "", errors.Errorf("log database not found in %q", basedir)
+	}
+
+	return dbdir, nil
+}
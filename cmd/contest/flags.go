@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/spikeekips/mitum/util"
+	"gopkg.in/yaml.v3"
 )
 
 type LogLevel struct {
@@ -88,3 +89,77 @@ func (f HostFlag) MarshalZerologObject(e *zerolog.Event) {
 func (f HostFlag) String() string {
 	return f.dockerhost.String()
 }
+
+type VarFlag struct {
+	value interface{}
+	key   string
+}
+
+func (f *VarFlag) UnmarshalText(b []byte) error {
+	e := util.StringError("parse var flag")
+
+	k, v, found := strings.Cut(string(b), "=")
+
+	switch {
+	case !found:
+		return e.Errorf("must be <key>=<value>, %q", string(b))
+	case !strings.HasPrefix(k, "."):
+		return e.Errorf("wrong key format; must start with `.`, %q", k)
+	}
+
+	// NOTE value is parsed as yaml, so `67` becomes number
+	var i interface{}
+
+	if err := yaml.Unmarshal([]byte(v), &i); err != nil {
+		return e.Wrap(err)
+	}
+
+	if i == nil {
+		i = v
+	}
+
+	f.key = k
+	f.value = i
+
+	return nil
+}
+
+func (f VarFlag) String() string {
+	return fmt.Sprintf("%s=%v", f.key, f.value)
+}
+
+type MatrixFlag struct {
+	key    string
+	values []interface{}
+}
+
+func (f *MatrixFlag) UnmarshalText(b []byte) error {
+	e := util.StringError("parse matrix flag")
+
+	k, v, found := strings.Cut(string(b), "=")
+
+	switch {
+	case !found:
+		return e.Errorf("must be <key>=<value>,<value>..., %q", string(b))
+	case !strings.HasPrefix(k, "."):
+		return e.Errorf("wrong key format; must start with `.`, %q", k)
+	}
+
+	l := strings.Split(v, ",")
+
+	f.values = make([]interface{}, len(l))
+
+	for i := range l {
+		var vf VarFlag
+
+		if err := vf.UnmarshalText([]byte(k + "=" + l[i])); err != nil {
+			return e.Wrap(err)
+		}
+
+		f.values[i] = vf.value
+	}
+
+	f.key = k
+
+	return nil
+}
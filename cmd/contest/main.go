@@ -42,8 +42,13 @@ func main() {
 	var cli struct { //nolint:govet //...
 		//revive:disable:nested-structs
 		launch.LoggingFlags `embed:"" prefix:"log."`
-		Run                 runCommand `cmd:"" help:"run contest"`
-		Version             struct{}   `cmd:"" help:"version"`
+		Run                 runCommand    `cmd:"" help:"run contest"`
+		Sweep               sweepCommand  `cmd:"" help:"run contest once per combination of matrix vars"`
+		Suite               suiteCommand  `cmd:"" help:"run contest for scenario files"`
+		Report              reportCommand `cmd:"" help:"render html timeline of finished contest"`
+		Replay              replayCommand `cmd:"" help:"evaluate scenario against logs of finished contest"`
+		Query               queryCommand  `cmd:"" help:"query logs of finished contest"`
+		Version             struct{}      `cmd:"" help:"version"`
 		//revive:enable:nested-structs
 	}
 
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/contest"
+	"github.com/spikeekips/mitum/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type queryCommand struct { //nolint:govet //...
+	BaseDir string   `arg:"" name:"base_directory" help:"base directory of contest" type:"existingdir"`
+	Filter  string   `arg:"" name:"filter" help:"mongodb filter in extended json" default:"{}"`
+	Node    []string `name:"node" help:"node alias"`
+	Since   string   `name:"since" help:"entries from; ulid of _id or time of t in RFC3339"`
+	Until   string   `name:"until" help:"entries until; ulid of _id or time of t in RFC3339"`
+	Project []string `name:"project" help:"fields to print"`
+	Sort    []string `name:"sort" help:"sort fields; prefix - for descending" default:"_id"`
+	Limit   int64    `name:"limit" help:"maximum number of entries"`
+	Format  string   `name:"format" help:"output format; json, table" enum:"json,table" default:"json"`
+}
+
+func (cmd *queryCommand) Run() error {
+	e := util.StringError("query")
+
+	query, err := cmd.query()
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	opts := options.Find()
+
+	sort := make(bson.D, len(cmd.Sort))
+
+	for i := range cmd.Sort {
+		switch k := cmd.Sort[i]; {
+		case strings.HasPrefix(k, "-"):
+			sort[i] = bson.E{Key: k[1:], Value: -1}
+		default:
+			sort[i] = bson.E{Key: strings.TrimPrefix(k, "+"), Value: 1}
+		}
+	}
+
+	opts = opts.SetSort(sort)
+
+	if cmd.Limit > 0 {
+		opts = opts.SetLimit(cmd.Limit)
+	}
+
+	if len(cmd.Project) > 0 {
+		p := bson.M{}
+
+		for i := range cmd.Project {
+			p[cmd.Project[i]] = 1
+		}
+
+		opts = opts.SetProjection(p)
+	}
+
+	log.Debug().Interface("query", query).Interface("options", opts).Msg("query")
+
+	db, closef, err := openContestDB(cmd.BaseDir)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	defer closef()
+
+	var rows [][]string
+
+	if err := db.Traverse(context.Background(), query, opts, func(record map[string]interface{}) (bool, error) {
+		switch cmd.Format {
+		case "table":
+			rows = append(rows, cmd.row(record))
+		default:
+			b, err := util.MarshalJSON(record)
+			if err != nil {
+				return false, err //nolint:wrapcheck //...
+			}
+
+			if _, err := fmt.Fprintln(os.Stdout, string(b)); err != nil {
+				return false, errors.WithStack(err)
+			}
+		}
+
+		return true, nil
+	}); err != nil {
+		return e.Wrap(err)
+	}
+
+	if cmd.Format == "table" {
+		return printSummary(os.Stdout, cmd.header(), rows)
+	}
+
+	return nil
+}
+
+func (cmd *queryCommand) query() (bson.M, error) {
+	var filter bson.M
+	if err := bson.UnmarshalExtJSON([]byte(cmd.Filter), false, &filter); err != nil {
+		return nil, errors.WithMessagef(err, "filter, %q", cmd.Filter)
+	}
+
+	and := bson.A{filter}
+
+	switch {
+	case len(cmd.Node) == 1:
+		and = append(and, bson.M{"node": cmd.Node[0]})
+	case len(cmd.Node) > 1:
+		and = append(and, bson.M{"node": bson.M{"$in": cmd.Node}})
+	}
+
+	for _, s := range [][2]string{{"$gte", cmd.Since}, {"$lte", cmd.Until}} {
+		if len(s[1]) < 1 {
+			continue
+		}
+
+		m, err := queryTimeRange(s[0], s[1])
+		if err != nil {
+			return nil, err
+		}
+
+		and = append(and, m)
+	}
+
+	if len(and) < 2 { //nolint:mnd //...
+		return filter, nil
+	}
+
+	return bson.M{"$and": and}, nil
+}
+
+func (cmd *queryCommand) header() []string {
+	if len(cmd.Project) > 0 {
+		return append([]string{"_id"}, cmd.Project...)
+	}
+
+	return []string{"_id", "t", "node", "message", "x"}
+}
+
+func (cmd *queryCommand) row(record map[string]interface{}) []string {
+	header := cmd.header()
+	row := make([]string, len(header))
+
+	if len(cmd.Project) > 0 {
+		for i := range header {
+			v, _ := recordValue(record, header[i])
+
+			row[i] = queryValueString(v)
+		}
+
+		return row
+	}
+
+	msg, found := recordValue(record, "x.message")
+	if !found {
+		msg = record["msg"]
+	}
+
+	row[0] = queryValueString(record["_id"])
+	row[1] = queryValueString(record["t"])
+	row[2] = queryValueString(record["node"])
+	row[3] = queryValueString(msg)
+	row[4] = queryValueString(record["x"])
+
+	return row
+}
+
+// queryTimeRange returns the range query by _id for ulid or by t for time.
+func queryTimeRange(op, s string) (bson.M, error) {
+	if contest.IsULID(s) {
+		return bson.M{"_id": bson.M{op: s}}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, errors.Errorf("since and until should be ulid or RFC3339 time, %q", s)
+	}
+
+	return bson.M{"t": bson.M{op: t}}, nil
+}
+
+func queryValueString(i interface{}) string {
+	switch t := i.(type) {
+	case nil:
+		return "-"
+	case string:
+		return t
+	case primitive.DateTime:
+		return t.Time().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	case map[string]interface{}, []interface{}:
+		b, err := util.MarshalJSON(t)
+		if err != nil {
+			return fmt.Sprintf("%v", t)
+		}
+
+		s := string(b)
+		if len(s) > 120 { //nolint:mnd //...
+			s = s[:117] + "..."
+		}
+
+		return s
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
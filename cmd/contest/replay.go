@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/contest"
+	"github.com/spikeekips/mitum/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type replayCommand struct { //nolint:govet //...
+	BaseDir  string        `arg:"" name:"base_directory" help:"base directory of contest" type:"existingdir"`
+	Design   string        `arg:"" name:"scenario" help:"scenario file" type:"existingfile"`
+	Vars     []VarFlag     `name:"var" sep:"none" help:"set scenario var, <key>=<value>; value is parsed as yaml"`
+	VarFiles []string      `name:"var-file" help:"yaml file of scenario vars" type:"existingfile"`
+	Timeout  time.Duration `name:"timeout" help:"stop replay after timeout" default:"1m"`
+	Step     time.Duration `name:"step" help:"log time advanced by each count query and unmatched query" default:"1s"`
+}
+
+func (cmd *replayCommand) Run() error {
+	e := util.StringError("replay")
+
+	vars, err := loadOverrideVars(cmd.VarFiles, cmd.Vars)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	design, _, err := contest.LoadDesignFile(cmd.Design, vars...)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	if err := design.IsValid(nil); err != nil {
+		return e.Wrap(err)
+	}
+
+	cvars, err := cmd.loadVars(design)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	db, closef, err := openContestDB(cmd.BaseDir)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	defer closef()
+
+	clock, err := newReplayClock(db, cmd.Step)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	interval := time.Millisecond * 10 //nolint:mnd //...
+
+	w := contest.NewWatchLogs(
+		design.Expects,
+		design.Invariants,
+		make(chan contest.LogEntry),
+		&interval,
+		cvars,
+		func(string) contest.Host { return nil },
+		clock.find,
+		clock.count,
+		clock.aggregate,
+		func(_ context.Context, action contest.ScenarioAction) error {
+			log.Info().Str("type", action.Type).Strs("args", action.Args).Msg("action skipped in replay")
+
+			return nil
+		},
+		func(context.Context, []contest.LogEntry) error {
+			return nil // NOTE the stored logs are not changed
+		},
+	)
+
+	_ = w.SetLogging(mlogging)
+	_ = w.SetClock(clock.time)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmd.Timeout)
+	defer cancel()
+
+	werr := <-w.Wait(ctx)
+
+	switch {
+	case werr == nil:
+	case errors.Is(werr, context.DeadlineExceeded):
+		log.Warn().Dur("timeout", cmd.Timeout).Msg("replay timed out")
+	default:
+		log.Error().Err(werr).Msg("replay stopped")
+	}
+
+	results := w.Results()
+
+	rows := make([][]string, len(results))
+
+	for i := range results {
+		rows[i] = clock.resultRow(results[i])
+	}
+
+	if err := writeSummary(filepath.Join(cmd.BaseDir, "replay.txt"),
+		[]string{"expect", "label", "status", "at", "record", "error"}, rows); err != nil {
+		return e.Wrap(err)
+	}
+
+	return nil
+}
+
+// loadVars loads the vars saved by run; the vars of scenario override them.
+func (cmd *replayCommand) loadVars(design contest.Design) (*contest.Vars, error) {
+	m := map[string]interface{}{}
+
+	switch b, err := os.ReadFile(filepath.Join(cmd.BaseDir, varsFile)); {
+	case os.IsNotExist(err):
+		log.Warn().Msg("vars.json not found; only the vars of scenario are used")
+	case err != nil:
+		return nil, errors.WithStack(err)
+	default:
+		if err := util.UnmarshalJSON(b, &m); err != nil {
+			return nil, err //nolint:wrapcheck //...
+		}
+	}
+
+	vars := contest.NewVars(m)
+
+	keys := make([]string, 0, len(design.Vars))
+
+	for k := range design.Vars {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for i := range keys {
+		vars.Set(keys[i], design.Vars[keys[i]])
+	}
+
+	vars = vars.AddFunc("uuid", func() string {
+		return util.UUID().String()
+	})
+
+	vars = vars.AddFunc("ulid", func() string {
+		return util.ULID().String()
+	})
+
+	return vars, nil
+}
+
+// replayClock replays the stored logs by the log time. The condition query
+// sees only the entries before the clock like the running contest; if not
+// found, the clock moves to the first matched entry after it, or by step
+// without matched entry. The query with contest.PeekQueryContextKey, like
+// invariants, does not move the clock.
+type replayClock struct {
+	start time.Time
+	now   time.Time
+	db    *contest.Mongodb
+	step  time.Duration
+	sync.Mutex
+}
+
+func newReplayClock(db *contest.Mongodb, step time.Duration) (*replayClock, error) {
+	c := &replayClock{db: db, step: step}
+
+	if err := db.Traverse(context.Background(), bson.M{},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(1),
+		func(record map[string]interface{}) (bool, error) {
+			c.start, _ = recordTime(record)
+
+			return false, nil
+		},
+	); err != nil {
+		return nil, err //nolint:wrapcheck //...
+	}
+
+	if c.start.IsZero() {
+		return nil, errors.Errorf("empty log database")
+	}
+
+	c.now = c.start
+
+	return c, nil
+}
+
+func (c *replayClock) time() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+func (c *replayClock) find(ctx context.Context, m bson.M) (interface{}, bool, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	var found map[string]interface{}
+
+	f := func(record map[string]interface{}) (bool, error) {
+		found = record
+
+		return false, nil
+	}
+
+	if err := c.db.Traverse(ctx, bson.M{"$and": bson.A{m, bson.M{"t": bson.M{"$lte": c.now}}}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(1), f); err != nil {
+		return nil, false, err //nolint:wrapcheck //...
+	}
+
+	switch {
+	case found != nil:
+		return found, true, nil
+	case isPeekQuery(ctx):
+		return nil, false, nil
+	}
+
+	if err := c.db.Traverse(ctx, bson.M{"$and": bson.A{m, bson.M{"t": bson.M{"$gt": c.now}}}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(1), f); err != nil {
+		return nil, false, err //nolint:wrapcheck //...
+	}
+
+	if found == nil {
+		c.now = c.now.Add(c.step)
+
+		return nil, false, nil
+	}
+
+	if t, ok := recordTime(found); ok {
+		c.now = t
+	}
+
+	return found, true, nil
+}
+
+// count counts the entries before the clock and then advances the clock by
+// step, so the next count sees the later entries.
+func (c *replayClock) count(ctx context.Context, m bson.M) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	n, err := c.db.Count(ctx, bson.M{"$and": bson.A{m, bson.M{"t": bson.M{"$lte": c.now}}}})
+	if err != nil {
+		return 0, err //nolint:wrapcheck //...
+	}
+
+	if !isPeekQuery(ctx) {
+		c.now = c.now.Add(c.step)
+	}
+
+	return n, nil
+}
+
+// aggregate runs the pipeline over the entries before the clock and advances
+// the clock like count.
+func (c *replayClock) aggregate(ctx context.Context, pipeline bson.A) ([]map[string]interface{}, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	docs, err := c.db.Aggregate(ctx, append(bson.A{bson.M{"$match": bson.M{"t": bson.M{"$lte": c.now}}}}, pipeline...))
+	if err != nil {
+		return nil, err //nolint:wrapcheck //...
+	}
+
+	if !isPeekQuery(ctx) {
+		c.now = c.now.Add(c.step)
+	}
+
+	return docs, nil
+}
+
+func (c *replayClock) resultRow(r contest.ExpectResult) []string {
+	var at time.Time
+	var ids []string
+
+	for i := range r.Records {
+		record, ok := r.Records[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if t, ok := recordTime(record); ok && t.After(at) {
+			at = t
+		}
+
+		if id, found := record["_id"]; found {
+			ids = append(ids, fmt.Sprintf("%v", id))
+		}
+	}
+
+	var s string
+	if !at.IsZero() {
+		s = "+" + at.Sub(c.start).Round(time.Millisecond).String()
+	}
+
+	label := r.Label
+	if len(label) < 1 {
+		label = "-"
+	}
+
+	return []string{
+		r.Path, label, string(r.Status), s, strings.Join(ids, ","), strings.Join(strings.Fields(r.Error), " "),
+	}
+}
+
+func recordTime(record map[string]interface{}) (time.Time, bool) {
+	t, ok := record["t"].(primitive.DateTime)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return t.Time(), true
+}
+
+func isPeekQuery(ctx context.Context) bool {
+	b, _ := ctx.Value(contest.PeekQueryContextKey).(bool)
+
+	return b
+}
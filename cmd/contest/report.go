@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/contest"
+	"github.com/spikeekips/mitum/util"
+)
+
+var reportFiles = map[string]string{
+	"json":  "report.json",
+	"junit": "report.xml",
+}
+
+type contestReport struct {
+	Started  time.Time              `json:"started"`
+	Finished time.Time              `json:"finished"`
+	ID       string                 `json:"id"`
+	Scenario string                 `json:"scenario"`
+	Duration string                 `json:"duration"`
+	Result   string                 `json:"result"`
+	Error    string                 `json:"error,omitempty"`
+	Expects  []contest.ExpectResult `json:"expects"`
+}
+
+func newContestReport(
+	id, scenario string, started time.Time, results []contest.ExpectResult, err error,
+) contestReport {
+	r := contestReport{
+		ID:       id,
+		Scenario: scenario,
+		Started:  started,
+		Finished: time.Now(),
+		Result:   "pass",
+		Expects:  results,
+	}
+
+	r.Duration = r.Finished.Sub(r.Started).String()
+
+	if err != nil {
+		r.Result = "fail"
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+func (r contestReport) write(basedir string, formats []string) error {
+	for i := range formats {
+		f := filepath.Join(basedir, reportFiles[formats[i]])
+
+		var b []byte
+
+		switch formats[i] {
+		case "json":
+			i, err := util.MarshalJSONIndent(r)
+			if err != nil {
+				return err //nolint:wrapcheck //...
+			}
+
+			b = i
+		case "junit":
+			i, err := r.junit()
+			if err != nil {
+				return err
+			}
+
+			b = i
+		default:
+			return errors.Errorf("unknown report format, %q", formats[i])
+		}
+
+		if err := os.WriteFile(f, b, 0o600); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+}
+
+type junitTestCase struct {
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	SystemOut *junitCData   `xml:"system-out,omitempty"`
+	Time      float64       `xml:"time,attr"`
+}
+
+type junitCData struct {
+	Text string `xml:",cdata"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+func (r contestReport) junit() ([]byte, error) {
+	name := strings.TrimSuffix(filepath.Base(r.Scenario), filepath.Ext(r.Scenario))
+
+	suite := junitTestSuite{
+		Name:      name,
+		Timestamp: r.Started.Format(time.RFC3339),
+		Time:      r.Finished.Sub(r.Started).Seconds(),
+	}
+
+	var failed bool
+
+	for i := range r.Expects {
+		e := r.Expects[i]
+
+		c := junitTestCase{
+			Name:      junitTestCaseName(e),
+			ClassName: name,
+			Time:      e.Duration().Seconds(),
+		}
+
+		b, err := util.MarshalJSONIndent(e)
+		if err != nil {
+			return nil, err //nolint:wrapcheck //...
+		}
+
+		c.SystemOut = &junitCData{Text: string(b)}
+
+		switch {
+		case e.Status == contest.ExpectResultError:
+			c.Error = &junitMessage{Message: e.Error, Type: string(e.Status), Text: e.Condition}
+			suite.Errors++
+			failed = true
+		case len(e.Error) > 0:
+			c.Failure = &junitMessage{Message: e.Error, Type: string(e.Status), Text: e.Condition}
+			suite.Failures++
+			failed = true
+		case e.Status == contest.ExpectResultPending, e.Status == contest.ExpectResultCanceled:
+			c.Skipped = &junitMessage{Message: string(e.Status)}
+			suite.Skipped++
+		}
+
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if len(r.Error) > 0 && !failed {
+		// NOTE the error not from expects, like timeout of contest
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      "contest",
+			ClassName: name,
+			Time:      suite.Time,
+			Failure:   &junitMessage{Message: r.Error},
+		})
+		suite.Failures++
+	}
+
+	suite.Tests = len(suite.Cases)
+
+	b, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+func junitTestCaseName(e contest.ExpectResult) string {
+	s := e.Condition
+	if len(e.Label) > 0 {
+		s = e.Label
+	}
+
+	s = strings.Join(strings.Fields(s), " ")
+
+	if r := []rune(s); len(r) > 80 { //nolint:mnd //...
+		s = string(r[:77]) + "..."
+	}
+
+	return fmt.Sprintf("expect #%s: %s", e.Path, s)
+}
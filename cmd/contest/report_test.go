@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/spikeekips/contest"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestJUnitTestCaseName(tt *testing.T) {
+	t := new(suite.Suite)
+	t.SetT(tt)
+
+	cases := []struct {
+		name   string
+		result contest.ExpectResult
+		s      string
+	}{
+		{
+			name:   "label",
+			result: contest.ExpectResult{Path: "0", Label: "ready", Condition: `{"msg": "ready"}`},
+			s:      "expect #0: ready",
+		},
+		{
+			name:   "condition",
+			result: contest.ExpectResult{Path: "1", Condition: "{\"msg\":\n  \"ready\"}"},
+			s:      `expect #1: {"msg": "ready"}`,
+		},
+		{
+			name:   "long",
+			result: contest.ExpectResult{Path: "2", Label: strings.Repeat("a", 81)},
+			s:      "expect #2: " + strings.Repeat("a", 77) + "...",
+		},
+		{
+			name:   "long multibyte",
+			result: contest.ExpectResult{Path: "3", Label: strings.Repeat("블록", 41)},
+			s:      "expect #3: " + string([]rune(strings.Repeat("블록", 41))[:77]) + "...",
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(c.name, func() {
+			s := junitTestCaseName(c.result)
+
+			t.True(utf8.ValidString(s), "%d: %v", i, c.name)
+			t.Equal(c.s, s, "%d: %v", i, c.name)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"debug/elf"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -13,21 +14,17 @@ import (
 )
 
 var (
-	contestID         = util.ULID().String()
 	DefaultNodeImage  = "debian:testing-slim"
 	DefaultRedisImage = "redis:latest"
 	DefaultNginxImage = "nginx:stable-alpine-slim"
 )
 
 type runCommand struct { //nolint:govet //...
-	BaseDir      string        `arg:"" name:"base_directory" help:"base directory"`
-	Design       string        `arg:"" name:"scenario" help:"scenario file" type:"existingfile"`
-	Hosts        []HostFlag    `arg:"" name:"host" help:"docker host"`
-	NodeBinaries []string      `name:"node-binary" help:"node binary files by architecture"`
-	Timeout      time.Duration `name:"timeout" help:"stop after timeout"`
-	PprofSeconds uint          `name:"pprof-seconds" help:"pprof trace seconds" default:"30"`
-	NodeArgs     []string      `name:"node-arg" help:"extra node args"`
-	db           *contest.Mongodb
+	BaseDir      string     `arg:"" name:"base_directory" help:"base directory"`
+	Design       string     `arg:"" name:"scenario" help:"scenario file" type:"existingfile"`
+	Hosts        []HostFlag `arg:"" name:"host" help:"docker host"`
+	runFlags     `embed:""`
+	db           contest.LogStore
 	basedir      string
 	design       contest.Design
 	vars         *contest.Vars
@@ -35,12 +32,47 @@ type runCommand struct { //nolint:govet //...
 	logch        chan contest.LogEntry
 	nodeBinaries map[elf.Machine]string
 	exitch       chan error
+	netfilter    *netFilter
+	netshaper    *netShaper
+	killedNodes  *util.SingleLockedMap[string, bool]
 	nodes        util.LockedMap[string, nodeInfo]
 	logFiles     util.LockedMap[string, *logFile]
 	mongodb      string
+	id           string
+	prepared     *preparedHosts
+}
+
+// runFlags is the flags for running contest; it is shared by the commands,
+// which run contest.
+type runFlags struct { //nolint:govet //...
+	NodeBinaries []string      `name:"node-binary" help:"node binary files by architecture"`
+	Timeout      time.Duration `name:"timeout" help:"stop after timeout"`
+	PprofSeconds uint          `name:"pprof-seconds" help:"pprof trace seconds" default:"30"`
+	NodeArgs     []string      `name:"node-arg" help:"extra node args"`
+	Vars         []VarFlag     `name:"var" sep:"none" help:"set scenario var, <key>=<value>; value is parsed as yaml"`
+	VarFiles     []string      `name:"var-file" help:"yaml file of scenario vars" type:"existingfile"`
+	Reports      []string      `name:"report" help:"write result report to base directory; json, junit" default:"json"`
+	LogStore     string        `name:"log-store" help:"log store; ferretdb, mongodb, memory" enum:"ferretdb,mongodb,memory" default:"ferretdb"` //nolint:lll //...
+	MongodbURI   string        `name:"mongodb" help:"external mongodb uri; database is suffixed by contest id"`
+	SlowQuery    time.Duration `name:"slow-query" help:"log condition queries slower than it; 0 disables" default:"1s"`
+	NetPrefix    string        `name:"net-command-prefix" help:"prefix of network commands in hosts, like 'sudo -n'"`
+}
+
+// preparedHosts keeps the node binaries uploaded and the images checked in
+// hosts, so the next runs with the same hosts can reuse them.
+type preparedHosts struct {
+	binaries *util.SingleLockedMap[string, string]
+	images   *util.SingleLockedMap[string, bool]
 }
 
-func (cmd *runCommand) Run() error {
+func newPreparedHosts() *preparedHosts {
+	return &preparedHosts{
+		binaries: util.NewSingleLockedMap[string, string](),
+		images:   util.NewSingleLockedMap[string, bool](),
+	}
+}
+
+func (cmd *runCommand) Run() (err error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -48,7 +80,10 @@ func (cmd *runCommand) Run() error {
 		return err
 	}
 
-	cmd.exitch = make(chan error)
+	cmd.exitch = make(chan error, 1)
+	cmd.netfilter = newNetFilter(cmd.id, cmd.NetPrefix)
+	cmd.netshaper = newNetShaper(cmd.id, cmd.NetPrefix)
+	cmd.killedNodes = util.NewSingleLockedMap[string, bool]()
 
 	started := time.Now()
 
@@ -81,6 +116,7 @@ func (cmd *runCommand) Run() error {
 
 	w := contest.NewWatchLogs(
 		cmd.design.Expects,
+		cmd.design.Invariants,
 		cmd.logch,
 		nil,
 		cmd.vars,
@@ -93,17 +129,33 @@ func (cmd *runCommand) Run() error {
 		func(ctx context.Context, m bson.M) (int64, error) {
 			return cmd.db.Count(ctx, m)
 		},
+		func(ctx context.Context, pipeline bson.A) ([]map[string]interface{}, error) {
+			return cmd.db.Aggregate(ctx, pipeline)
+		},
 		cmd.action,
 		cmd.db.InsertLogEntries,
 	)
 
 	_ = w.SetLogging(mlogging)
+	_ = w.SetSlowQuery(cmd.SlowQuery)
+
+	defer func() {
+		if len(cmd.Reports) < 1 {
+			return
+		}
+
+		r := newContestReport(cmd.id, cmd.Design, started, w.Results(), err)
+
+		if rerr := r.write(cmd.basedir, cmd.Reports); rerr != nil {
+			log.Error().Err(rerr).Msg("failed to write report")
+		}
+	}()
 
 	cmd.nodes, _ = util.NewLockedMap[string, nodeInfo](1, nil)
 	cmd.logFiles, _ = util.NewLockedMap[string, *logFile](1, nil)
 
 	go func() {
-		cmd.exitch <- <-w.Wait(ctx)
+		cmd.exit(ctx, <-w.Wait(ctx))
 	}()
 
 	cmd.logch <- contest.NewInternalLogEntry("contest ready", nil)
@@ -116,12 +168,20 @@ func (cmd *runCommand) Run() error {
 
 		return time.After(cmd.Timeout)
 	}():
+		// NOTE the waiting expects are read before cancel; the canceled
+		// expects are not waiting anymore.
+		waiting := w.WaitingExpects()
+
 		cmd.collectPprofs()
 
 		cancel()
 
 		log.Debug().Dur("timeout", cmd.Timeout).Msg("contest will be stopped by timeout")
 
+		if len(waiting) > 0 {
+			return errors.Errorf("timeout after %s; waiting %s", cmd.Timeout, strings.Join(waiting, ", "))
+		}
+
 		return errors.Errorf("timeout after %s", cmd.Timeout)
 	case err := <-cmd.exitch:
 		cancel()
@@ -136,10 +196,31 @@ func (cmd *runCommand) Run() error {
 	return nil
 }
 
+// exit sends the error to stop contest. exitch is read once, so the later
+// sends are dropped after Run returns; suite and sweep run many times.
+func (cmd *runCommand) exit(ctx context.Context, err error) {
+	select {
+	case cmd.exitch <- err:
+	case <-ctx.Done():
+	}
+}
+
 func (cmd *runCommand) closeHosts(ctx context.Context) error {
 	log.Debug().Msg("trying to close hosts")
 	defer log.Debug().Msg("hosts closed")
 
+	if cmd.netfilter != nil {
+		if err := cmd.netfilter.clean(); err != nil {
+			log.Error().Err(err).Msg("failed to clean network rules")
+		}
+	}
+
+	if cmd.netshaper != nil {
+		if err := cmd.netshaper.clean(); err != nil {
+			log.Error().Err(err).Msg("failed to clean netem rules")
+		}
+	}
+
 	_ = cmd.hosts.Traverse(func(host contest.Host) (bool, error) {
 		log.Debug().Str("host", host.HostID()).Msg("trying to collect result")
 		defer log.Debug().Str("host", host.HostID()).Msg("collected result")
@@ -35,7 +35,7 @@ func (cmd *runCommand) action(ctx context.Context, action contest.ScenarioAction
 			err = errors.New(action.Args[0])
 		}
 
-		cmd.exitch <- err
+		cmd.exit(ctx, err)
 
 		return nil
 	case "init-nodes":
@@ -87,6 +87,45 @@ func (cmd *runCommand) action(ctx context.Context, action contest.ScenarioAction
 			}); err != nil {
 			return errors.WithMessage(err, "stop node")
 		}
+	case "restart-nodes":
+		if err := cmd.rangeNodes(ctx, action,
+			func(ctx context.Context, host contest.Host, alias string, _ []string, properties map[string]interface{}) error {
+				log.Debug().
+					Str("host", host.Address()).
+					Str("alias", alias).
+					Interface("properties", properties).
+					Msg("run restart-nodes")
+
+				return cmd.restartNodes(ctx, alias, properties)
+			}); err != nil {
+			return errors.WithMessage(err, "restart node")
+		}
+	case "pause-nodes", "unpause-nodes", "kill-nodes":
+		if err := cmd.rangeNodes(ctx, action,
+			func(ctx context.Context, host contest.Host, alias string, args []string, properties map[string]interface{}) error {
+				log.Debug().
+					Str("host", host.Address()).
+					Str("alias", alias).
+					Strs("args", args).
+					Msgf("run %s", action.Type)
+
+				switch action.Type {
+				case "pause-nodes":
+					return cmd.pauseNodes(ctx, alias)
+				case "unpause-nodes":
+					return cmd.unpauseNodes(ctx, alias)
+				default:
+					var signal string
+
+					if _, err := contest.ScenarioActionProperty(properties, "signal", &signal); err != nil {
+						return err //nolint:wrapcheck //...
+					}
+
+					return cmd.killNodes(ctx, alias, signal)
+				}
+			}); err != nil {
+			return errors.WithMessage(err, action.Type)
+		}
 	case "host-command":
 		if err := cmd.rangeNodes(ctx, action,
 			func(_ context.Context, host contest.Host, alias string, args []string, _ map[string]interface{}) error {
@@ -114,17 +153,69 @@ func (cmd *runCommand) action(ctx context.Context, action contest.ScenarioAction
 		); err != nil {
 			return errors.WithMessage(err, "run host command")
 		}
+	case "partition":
+		properties, err := action.CompileProperties(cmd.vars)
+		if err != nil {
+			return errors.WithMessage(err, "partition")
+		}
+
+		if err := cmd.partition(ctx, properties); err != nil {
+			return err
+		}
+	case "heal":
+		if err := cmd.netfilter.heal(); err != nil {
+			return errors.WithMessage(err, "heal")
+		}
+	case "network-delay", "network-restore":
+		if err := cmd.rangeNodes(ctx, action,
+			func(ctx context.Context, _ contest.Host, alias string, _ []string, properties map[string]interface{}) error {
+				nodes, err := cmd.netNodes(ctx, []string{alias})
+				if err != nil {
+					return err
+				}
+
+				if action.Type == "network-restore" {
+					return cmd.netshaper.restore(nodes[0])
+				}
+
+				netem, err := netemArgs(properties)
+				if err != nil {
+					return err
+				}
+
+				log.Debug().Str("alias", alias).Str("netem", netem).Msg("run network-delay")
+
+				return cmd.netshaper.apply(nodes[0], netem)
+			},
+		); err != nil {
+			return errors.WithMessage(err, action.Type)
+		}
+	case "clock-skew":
+		if err := cmd.rangeNodes(ctx, action,
+			func(_ context.Context, host contest.Host, alias string, _ []string, properties map[string]interface{}) error {
+				offset, err := clockSkewOffset(properties)
+				if err != nil {
+					return err
+				}
+
+				log.Debug().Str("alias", alias).Stringer("offset", offset).Msg("run clock-skew")
+
+				return setClockSkew(host, alias, offset)
+			},
+		); err != nil {
+			return errors.WithMessage(err, action.Type)
+		}
 	case "run-redis":
 		err := cmd.hosts.TraverseByHost(func(h contest.Host, _ []string) (bool, error) {
 			if err := cmd.startRedisContainer(ctx, h, func(body container.WaitResponse, err error) {
 				if err != nil {
-					cmd.exitch <- err
+					cmd.exit(ctx, err)
 
 					return
 				}
 
 				if body.Error != nil {
-					cmd.exitch <- errors.New(body.Error.Message)
+					cmd.exit(ctx, errors.New(body.Error.Message))
 				}
 			}); err != nil {
 				return false, err
@@ -154,13 +245,13 @@ func (cmd *runCommand) action(ctx context.Context, action contest.ScenarioAction
 
 				return cmd.startNginxContainer(ctx, host, properties, func(body container.WaitResponse, err error) {
 					if err != nil {
-						cmd.exitch <- err
+						cmd.exit(ctx, err)
 
 						return
 					}
 
 					if body.Error != nil {
-						cmd.exitch <- errors.New(body.Error.Message)
+						cmd.exit(ctx, errors.New(body.Error.Message))
 					}
 				})
 			},
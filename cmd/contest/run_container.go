@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
 	dockerMount "github.com/docker/docker/api/types/mount"
@@ -21,10 +22,23 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// nodeInfo keeps the last run of node; it is kept after the node exits, so the
+// node can be restarted with the same args.
 type nodeInfo struct {
 	host          contest.Host
+	exited        chan struct{}
 	alias         string
 	debugHTTPPort string
+	args          []string
+}
+
+func (i nodeInfo) isRunning() bool {
+	select {
+	case <-i.exited:
+		return false
+	default:
+		return true
+	}
 }
 
 func (i nodeInfo) MarshalZerologObject(e *zerolog.Event) {
@@ -199,7 +213,7 @@ func (*runCommand) startNginxContainer(
 func (cmd *runCommand) initNode(
 	ctx context.Context, host contest.Host, alias string, args []string,
 ) error {
-	return cmd.doRunNode(ctx, host, alias, args)
+	return cmd.doRunNode(ctx, host, alias, args, nil)
 }
 
 func (cmd *runCommand) runNode(
@@ -210,20 +224,29 @@ func (cmd *runCommand) runNode(
 		return err //nolint:wrapcheck //...
 	}
 
+	info := nodeInfo{
+		alias:         alias,
+		debugHTTPPort: port,
+		host:          host,
+		args:          append([]string(nil), args...),
+		exited:        make(chan struct{}),
+	}
+
 	args = append(args, //revive:disable-line:modifies-parameter
-		fmt.Sprintf(`--dev.debug-http=:%s`, port), "--dev.pprof")
+		fmt.Sprintf(`--dev.debug-http=:%s`, port), "--dev.pprof",
+		"--dev.clock-skew="+filepath.Join("/data", nodeClockSkewFile))
 
-	if err := cmd.doRunNode(ctx, host, alias, args); err != nil {
+	if err := cmd.doRunNode(ctx, host, alias, args, info.exited); err != nil {
 		return err
 	}
 
-	_ = cmd.nodes.SetValue(alias, nodeInfo{alias: alias, debugHTTPPort: port, host: host})
+	_ = cmd.nodes.SetValue(alias, info)
 
 	return nil
 }
 
 func (cmd *runCommand) doRunNode( //revive:disable-line:cyclomatic
-	ctx context.Context, host contest.Host, alias string, args []string,
+	ctx context.Context, host contest.Host, alias string, args []string, exited chan struct{},
 ) error {
 	e := util.StringError("run node")
 
@@ -280,7 +303,11 @@ func (cmd *runCommand) doRunNode( //revive:disable-line:cyclomatic
 		nil,
 		name,
 		func(body container.WaitResponse, err error) {
-			_ = cmd.nodes.RemoveValue(alias)
+			if exited != nil {
+				defer close(exited)
+			}
+
+			killed := cmd.killedNodes.RemoveValue(alias)
 
 			l := log.With().Stringer("logid", util.UUID()).Logger()
 
@@ -297,7 +324,7 @@ func (cmd *runCommand) doRunNode( //revive:disable-line:cyclomatic
 					Bool("ignore", cmd.design.IgnoreAbnormalContainerExit)
 			}().Msg("container stopped")
 
-			if !cmd.design.IgnoreAbnormalContainerExit && !errors.Is(err, context.Canceled) {
+			if !cmd.design.IgnoreAbnormalContainerExit && !killed && !errors.Is(err, context.Canceled) {
 				var exiterr error
 
 				switch {
@@ -313,7 +340,7 @@ func (cmd *runCommand) doRunNode( //revive:disable-line:cyclomatic
 				}
 
 				if exiterr != nil {
-					cmd.exitch <- exiterr
+					cmd.exit(ctx, exiterr)
 
 					return
 				}
@@ -377,6 +404,12 @@ func (cmd *runCommand) stopNodes(ctx context.Context, alias string, _ []string)
 	case err != nil:
 		return e.Wrap(err)
 	case !found:
+	case info == "paused":
+		if err := host.UnpauseContainer(ctx, name); err != nil {
+			return e.Wrap(err)
+		}
+
+		fallthrough
 	case info == "running", info == "restarting":
 		if err := host.StopContainer(ctx, name, nil); err != nil {
 			return e.Wrap(err)
@@ -386,6 +419,237 @@ func (cmd *runCommand) stopNodes(ctx context.Context, alias string, _ []string)
 	return nil
 }
 
+// pauseNodes freezes the processes of node; unlike stop, the sockets of node
+// are kept open.
+func (cmd *runCommand) pauseNodes(ctx context.Context, alias string) error {
+	e := util.StringError("pause node")
+
+	host, name, info, err := cmd.nodeContainer(ctx, alias)
+
+	switch {
+	case err != nil:
+		return e.Wrap(err)
+	case info != "running":
+		return e.Errorf("not running, %q", info)
+	}
+
+	return e.Wrap(host.PauseContainer(ctx, name))
+}
+
+func (cmd *runCommand) unpauseNodes(ctx context.Context, alias string) error {
+	e := util.StringError("unpause node")
+
+	host, name, info, err := cmd.nodeContainer(ctx, alias)
+
+	switch {
+	case err != nil:
+		return e.Wrap(err)
+	case info != "paused":
+		return e.Errorf("not paused, %q", info)
+	}
+
+	return e.Wrap(host.UnpauseContainer(ctx, name))
+}
+
+// killNodes sends the signal to node without graceful stop. The exit of node
+// killed by kill-nodes is not regarded as abnormal for any signal.
+func (cmd *runCommand) killNodes(ctx context.Context, alias, signal string) error {
+	e := util.StringError("kill node")
+
+	host, name, info, err := cmd.nodeContainer(ctx, alias)
+
+	switch {
+	case err != nil:
+		return e.Wrap(err)
+	case info != "running" && info != "paused" && info != "restarting":
+		return e.Errorf("not running, %q", info)
+	}
+
+	_ = cmd.killedNodes.SetValue(alias, true)
+
+	if err := killContainer(ctx, host, name, info, signal); err != nil {
+		_ = cmd.killedNodes.RemoveValue(alias)
+
+		return e.Wrap(err)
+	}
+
+	return nil
+}
+
+// killContainer unpauses the paused container before the signal except
+// SIGKILL; the frozen processes can not handle the signal, so it stays
+// pending.
+func killContainer(ctx context.Context, host contest.Host, name, info, signal string) error {
+	if info == "paused" && !isKillSignal(signal) {
+		if err := host.UnpauseContainer(ctx, name); err != nil {
+			return errors.WithMessage(err, "unpause")
+		}
+	}
+
+	return host.KillContainer(ctx, name, signal) //nolint:wrapcheck //...
+}
+
+// isKillSignal checks whether the signal is SIGKILL; empty signal is SIGKILL.
+func isKillSignal(signal string) bool {
+	switch strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(signal)), "SIG") {
+	case "", "KILL", "9":
+		return true
+	default:
+		return false
+	}
+}
+
+// restartNodes stops the node and runs it again with the args of the last run;
+// `remove_args` removes the matched args, `--a` also removes `--a=<value>`, and
+// `extra_args` are appended.
+func (cmd *runCommand) restartNodes(ctx context.Context, alias string, properties map[string]interface{}) error {
+	e := util.StringError("restart node")
+
+	info, found := cmd.nodes.Value(alias)
+	if !found {
+		return e.Errorf("not run yet")
+	}
+
+	var delay time.Duration
+
+	var s string
+
+	switch found, err := actionPropertyYAML(properties, "delay", &s); {
+	case err != nil:
+		return e.Wrap(err)
+	case found:
+		i, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return e.WithMessage(err, "delay")
+		}
+
+		delay = i
+	}
+
+	var extra, remove []string
+
+	for k, v := range map[string]*[]string{"extra_args": &extra, "remove_args": &remove} {
+		if _, err := actionPropertyYAML(properties, k, v); err != nil {
+			return e.Wrap(err)
+		}
+	}
+
+	args := restartArgs(info.args, remove, extra)
+
+	cmd.logch <- contest.NewInternalLogEntryWithX("node restarting", nil, bson.M{
+		"node":  alias,
+		"delay": delay.String(),
+		"args":  args,
+	})
+
+	if err := cmd.stopNodes(ctx, alias, nil); err != nil {
+		return e.Wrap(err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return e.Wrap(ctx.Err())
+	case <-info.exited:
+	}
+
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+			return e.Wrap(ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+
+	if err := cmd.runNode(ctx, info.host, alias, args); err != nil {
+		return e.Wrap(err)
+	}
+
+	cmd.logch <- contest.NewInternalLogEntryWithX("node restarted", nil, bson.M{"node": alias})
+
+	return nil
+}
+
+func restartArgs(args, remove, extra []string) []string {
+	nargs := make([]string, 0, len(args)+len(extra))
+
+end:
+	for i := range args {
+		for j := range remove {
+			if args[i] == remove[j] ||
+				(strings.HasPrefix(remove[j], "--") && strings.HasPrefix(args[i], remove[j]+"=")) {
+				continue end
+			}
+		}
+
+		nargs = append(nargs, args[i])
+	}
+
+	return append(nargs, extra...)
+}
+
+// nodeClockSkewFile is the clock skew file in node directory.
+const nodeClockSkewFile = "clock-skew"
+
+// clockSkewOffset parses the "offset" property of clock-skew action, like
+// "-3s"; "0s" restores the clock. The node ignores the offset under 500ms,
+// which is the allowed offset of mitum time syncer.
+func clockSkewOffset(properties map[string]interface{}) (time.Duration, error) {
+	var v string
+
+	switch found, err := actionPropertyYAML(properties, "offset", &v); {
+	case err != nil:
+		return 0, err
+	case !found:
+		return 0, errors.Errorf("empty offset")
+	}
+
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return 0, errors.WithMessage(err, "offset")
+	}
+
+	return d, nil
+}
+
+// setClockSkew writes the clock offset to the clock skew file in the node
+// directory; the node reads it thru --dev.clock-skew at every time sync, so
+// the offset set before run-nodes shifts the clock from the start.
+func setClockSkew(host contest.Host, alias string, offset time.Duration) error {
+	f := filepath.Join(host.Base(), alias, nodeClockSkewFile)
+
+	switch _, stderr, ok, err := host.RunCommand(fmt.Sprintf(
+		"mkdir -p %[1]q && printf '%%s' %[2]q > %[3]q.tmp && mv -f %[3]q.tmp %[3]q",
+		filepath.Dir(f), offset.String(), f,
+	)); {
+	case err != nil:
+		return errors.WithStack(err)
+	case !ok:
+		return errors.Errorf("set clock skew in host, %q; %s", host.Address(), strings.TrimSpace(stderr))
+	default:
+		return nil
+	}
+}
+
+func (cmd *runCommand) nodeContainer(ctx context.Context, alias string) (
+	host contest.Host, name, info string, _ error,
+) {
+	name = containerName(alias)
+
+	host = cmd.hosts.HostByContainer(name)
+	if host == nil {
+		return nil, name, "", errors.Errorf("host not found")
+	}
+
+	switch _, info, found, err := host.ExistsContainer(ctx, name); {
+	case err != nil:
+		return nil, name, "", err //nolint:wrapcheck //...
+	case !found:
+		return nil, name, "", errors.Errorf("container not found")
+	default:
+		return host, name, info, nil
+	}
+}
+
 func (*runCommand) nodeContainerConfigs(alias string, host contest.Host) (
 	*container.Config,
 	*container.HostConfig,
@@ -493,6 +757,10 @@ func (cmd *runCommand) collectPprofs() {
 	defer worker.Close()
 
 	cmd.nodes.Traverse(func(_ string, info nodeInfo) bool {
+		if !info.isRunning() {
+			return true
+		}
+
 		if err := worker.NewJob(func(ctx context.Context, _ uint64) error {
 			l := log.With().Object("node_info", info).Logger()
 
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/contest"
+	"github.com/stretchr/testify/suite"
+)
+
+// testHost runs the command by local shell.
+type testHost struct {
+	contest.Host
+	base string
+}
+
+func (h testHost) Base() string {
+	return h.base
+}
+
+func (testHost) Address() string {
+	return "local"
+}
+
+func (testHost) RunCommand(s string) (stdout, stderr string, ok bool, err error) {
+	b, err := exec.Command("sh", "-c", s).CombinedOutput() //nolint:gosec //...
+	if err != nil {
+		return "", string(b), false, nil
+	}
+
+	return string(b), "", true, nil
+}
+
+type testClockSkew struct {
+	suite.Suite
+}
+
+func (t *testClockSkew) TestOffset() {
+	cases := []struct {
+		name       string
+		properties map[string]interface{}
+		offset     time.Duration
+		err        string
+	}{
+		{name: "forward", properties: map[string]interface{}{"offset": "3s"}, offset: time.Second * 3},
+		{name: "backward", properties: map[string]interface{}{"offset": " -1m30s "}, offset: -time.Second * 90},
+		{name: "restore", properties: map[string]interface{}{"offset": "0s"}},
+		{name: "empty", properties: map[string]interface{}{}, err: "empty offset"},
+		{name: "wrong", properties: map[string]interface{}{"offset": "3"}, err: "offset"},
+	}
+
+	for i, c := range cases {
+		t.Run(c.name, func() {
+			offset, err := clockSkewOffset(c.properties)
+			if len(c.err) > 0 {
+				t.Error(err, "%d: %v", i, c.name)
+				t.ErrorContains(err, c.err, "%d: %v", i, c.name)
+
+				return
+			}
+
+			t.NoError(err, "%d: %v", i, c.name)
+			t.Equal(c.offset, offset, "%d: %v", i, c.name)
+		})
+	}
+}
+
+func (t *testClockSkew) TestSet() {
+	host := testHost{base: t.T().TempDir()}
+	f := filepath.Join(host.base, "no0", nodeClockSkewFile)
+
+	t.Run("before node directory", func() {
+		t.NoError(setClockSkew(host, "no0", time.Second*3))
+
+		b, err := os.ReadFile(f)
+		t.NoError(err)
+		t.Equal("3s", string(b))
+	})
+
+	t.Run("override", func() {
+		t.NoError(setClockSkew(host, "no0", -time.Minute))
+
+		b, err := os.ReadFile(f)
+		t.NoError(err)
+		t.Equal("-1m0s", string(b))
+	})
+}
+
+func TestClockSkew(t *testing.T) {
+	suite.Run(t, new(testClockSkew))
+}
+
+type testKillContainerHost struct {
+	contest.Host
+	unpauseErr error
+	calls      []string
+}
+
+func (h *testKillContainerHost) UnpauseContainer(_ context.Context, name string) error {
+	if h.unpauseErr != nil {
+		return h.unpauseErr
+	}
+
+	h.calls = append(h.calls, "unpause "+name)
+
+	return nil
+}
+
+func (h *testKillContainerHost) KillContainer(_ context.Context, name, signal string) error {
+	h.calls = append(h.calls, "kill "+name+" "+signal)
+
+	return nil
+}
+
+type testKillNodes struct {
+	suite.Suite
+}
+
+func (t *testKillNodes) TestKillSignal() {
+	cases := []struct {
+		signal string
+		kill   bool
+	}{
+		{signal: "", kill: true},
+		{signal: "KILL", kill: true},
+		{signal: "SIGKILL", kill: true},
+		{signal: "sigkill", kill: true},
+		{signal: " 9 ", kill: true},
+		{signal: "TERM"},
+		{signal: "SIGTERM"},
+		{signal: "15"},
+		{signal: "SIGUSR1"},
+		{signal: "killme"},
+	}
+
+	for i, c := range cases {
+		t.Equal(c.kill, isKillSignal(c.signal), "%d: %q", i, c.signal)
+	}
+}
+
+func (t *testKillNodes) TestPaused() {
+	cases := []struct {
+		name   string
+		info   string
+		signal string
+		calls  []string
+	}{
+		{name: "paused; term", info: "paused", signal: "SIGTERM", calls: []string{"unpause no0", "kill no0 SIGTERM"}},
+		{name: "paused; kill", info: "paused", signal: "SIGKILL", calls: []string{"kill no0 SIGKILL"}},
+		{name: "paused; empty", info: "paused", calls: []string{"kill no0 "}},
+		{name: "running; term", info: "running", signal: "SIGTERM", calls: []string{"kill no0 SIGTERM"}},
+	}
+
+	for i, c := range cases {
+		t.Run(c.name, func() {
+			host := &testKillContainerHost{}
+
+			t.NoError(killContainer(context.Background(), host, "no0", c.info, c.signal), "%d: %v", i, c.name)
+			t.Equal(c.calls, host.calls, "%d: %v", i, c.name)
+		})
+	}
+
+	t.Run("failed to unpause", func() {
+		host := &testKillContainerHost{unpauseErr: errors.Errorf("killme")}
+
+		err := killContainer(context.Background(), host, "no0", "paused", "SIGTERM")
+		t.Error(err)
+		t.ErrorContains(err, "unpause")
+		t.Empty(host.calls)
+	})
+}
+
+func TestKillNodes(t *testing.T) {
+	suite.Run(t, new(testKillNodes))
+}
+
+func TestRestartArgs(tt *testing.T) {
+	t := new(suite.Suite)
+	t.SetT(tt)
+
+	args := []string{"/cmd", "run", "--design=config.yml", "--hold", "3", "--dev.allow-consensus"}
+
+	cases := []struct {
+		name   string
+		remove []string
+		extra  []string
+		args   []string
+	}{
+		{
+			name: "nothing",
+			args: args,
+		},
+		{
+			name:  "append",
+			extra: []string{"--hold="},
+			args:  []string{"/cmd", "run", "--design=config.yml", "--hold", "3", "--dev.allow-consensus", "--hold="},
+		},
+		{
+			name:   "override flag=value",
+			remove: []string{"--design"},
+			extra:  []string{"--design=new.yml"},
+			args:   []string{"/cmd", "run", "--hold", "3", "--dev.allow-consensus", "--design=new.yml"},
+		},
+		{
+			name:   "override flag value",
+			remove: []string{"--hold", "3"},
+			extra:  []string{"--hold", "9"},
+			args:   []string{"/cmd", "run", "--design=config.yml", "--dev.allow-consensus", "--hold", "9"},
+		},
+		{
+			name:   "exact flag=value",
+			remove: []string{"--design=config.yml"},
+			args:   []string{"/cmd", "run", "--hold", "3", "--dev.allow-consensus"},
+		},
+		{
+			name:   "prefix not matched",
+			remove: []string{"--dev"},
+			args:   args,
+		},
+		{
+			name:   "unknown",
+			remove: []string{"--killme"},
+			args:   args,
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(c.name, func() {
+			t.Equal(c.args, restartArgs(args, c.remove, c.extra), "%d: %v", i, c.name)
+		})
+	}
+
+	t.Equal([]string{"/cmd", "run", "--design=config.yml", "--hold", "3", "--dev.allow-consensus"}, args)
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/contest"
+	"github.com/spikeekips/mitum/util"
+	"gopkg.in/yaml.v3"
+)
+
+// netFilter manages the packet filter rules of contest in the hosts. The rules
+// are kept in the own chain of contest, which is jumped from OUTPUT, so heal and
+// cleanup remove only them.
+type netFilter struct {
+	hosts  map[string]contest.Host
+	prefix string
+	chain  string
+	sync.Mutex
+}
+
+func newNetFilter(id, prefix string) *netFilter {
+	if len(id) > 12 { //nolint:mnd // NOTE iptables chain name is limited in length
+		id = id[len(id)-12:]
+	}
+
+	return &netFilter{
+		hosts:  map[string]contest.Host{},
+		prefix: strings.TrimSpace(prefix),
+		chain:  "contest-" + strings.ToLower(id),
+	}
+}
+
+func (f *netFilter) iptables(args string) string {
+	return netCommand(f.prefix, "iptables "+args)
+}
+
+// set replaces the rules of hosts with the new rules.
+func (f *netFilter) set(hosts map[string]contest.Host, rules map[string][]string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.flush(); err != nil {
+		return err
+	}
+
+	for _, id := range sortedHostIDs(hosts) {
+		host := hosts[id]
+
+		// NOTE create the chain of contest and jump to it from OUTPUT
+		cmds := []string{fmt.Sprintf("%s 2>/dev/null; %s 2>/dev/null || %s",
+			f.iptables("-N "+f.chain),
+			f.iptables("-C OUTPUT -j "+f.chain),
+			f.iptables("-I OUTPUT -j "+f.chain),
+		)}
+
+		for i := range rules[id] {
+			cmds = append(cmds, f.iptables("-A "+f.chain+" "+rules[id][i]))
+		}
+
+		f.hosts[id] = host
+
+		if err := runNetCommand(host, strings.Join(cmds, " && ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// heal removes the rules from the hosts.
+func (f *netFilter) heal() error {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.flush()
+}
+
+// clean removes the chain of contest from the hosts.
+func (f *netFilter) clean() error {
+	f.Lock()
+	defer f.Unlock()
+
+	for _, id := range sortedHostIDs(f.hosts) {
+		if err := runNetCommand(f.hosts[id], strings.Join([]string{
+			f.iptables("-D OUTPUT -j " + f.chain),
+			f.iptables("-F " + f.chain),
+			f.iptables("-X " + f.chain),
+		}, "; ")); err != nil {
+			return err
+		}
+
+		delete(f.hosts, id)
+	}
+
+	return nil
+}
+
+func (f *netFilter) flush() error {
+	for _, id := range sortedHostIDs(f.hosts) {
+		if err := runNetCommand(f.hosts[id], f.iptables("-F "+f.chain)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func netCommand(prefix, s string) string {
+	if len(prefix) < 1 {
+		return s
+	}
+
+	return prefix + " " + s
+}
+
+func runNetCommand(host contest.Host, s string) error {
+	log.Debug().Str("host", host.Address()).Str("cmd", s).Msg("run network command")
+
+	switch _, stderr, ok, err := host.RunCommand(s); {
+	case err != nil:
+		return errors.WithStack(err)
+	case !ok:
+		return errors.Errorf("network command failed in host, %q; %s", host.Address(), strings.TrimSpace(stderr))
+	default:
+		return nil
+	}
+}
+
+// netShaper manages the netem rules of nodes. The nodes share the network of
+// host, so every packet sent by node is classified to the class of node by the
+// cgroup of its container in lo and the interface of default route; the
+// outgoing dials from the ephemeral ports are also shaped.
+type netShaper struct {
+	hosts   map[string]contest.Host
+	classes map[string]int
+	rules   map[string]string
+	prefix  string
+	chain   string
+	next    int
+	sync.Mutex
+}
+
+func newNetShaper(id, prefix string) *netShaper {
+	if len(id) > 12 { //nolint:mnd // NOTE iptables chain name is limited in length
+		id = id[len(id)-12:]
+	}
+
+	return &netShaper{
+		hosts:   map[string]contest.Host{},
+		classes: map[string]int{},
+		rules:   map[string]string{},
+		prefix:  strings.TrimSpace(prefix),
+		chain:   "contest-" + strings.ToLower(id),
+		next:    0x10, //nolint:mnd //...
+	}
+}
+
+const (
+	netShaperHandle  = "1f00"
+	netShaperDevices = `lo $(ip route show default | awk '{print $5}' | sort -u)`
+)
+
+func (s *netShaper) tc(args string) string {
+	return netCommand(s.prefix, "tc "+args)
+}
+
+func (s *netShaper) iptables(args string) string {
+	return netCommand(s.prefix, "iptables -t mangle "+args)
+}
+
+// apply sets the netem of node; the previous netem of node is replaced.
+func (s *netShaper) apply(node netNode, netem string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	class, found := s.classes[node.alias]
+	if !found {
+		class = s.next
+	}
+
+	h := netShaperHandle
+	classid := fmt.Sprintf("%s:%x", h, class)
+
+	script := strings.Join([]string{
+		fmt.Sprintf(`(%s | grep -q "htb %s:") || (%s && %s) || exit 1`,
+			s.tc("qdisc show dev $dev"), h,
+			s.tc(fmt.Sprintf("qdisc add dev $dev root handle %s: htb default 1", h)),
+			s.tc(fmt.Sprintf("class add dev $dev parent %s: classid %s:1 htb rate 100gbit", h, h)),
+		),
+		s.tc(fmt.Sprintf("class replace dev $dev parent %s: classid %s htb rate 100gbit", h, classid)) + " || exit 1",
+		s.tc(fmt.Sprintf("qdisc replace dev $dev parent %s handle %x: %s", classid, class, netem)) + " || exit 1",
+	}, "; ")
+
+	rule := netShaperRule(node.cgroup, class)
+
+	cmds := []string{
+		fmt.Sprintf("for dev in %s; do %s; done", netShaperDevices, script),
+		fmt.Sprintf("(%s 2>/dev/null; %s 2>/dev/null || %s)",
+			s.iptables("-N "+s.chain),
+			s.iptables("-C OUTPUT -j "+s.chain),
+			s.iptables("-I OUTPUT -j "+s.chain),
+		),
+	}
+
+	if old, found := s.rules[node.alias]; found {
+		cmds = append(cmds, "("+s.iptables("-D "+s.chain+" "+old)+" 2>/dev/null; true)")
+	}
+
+	cmds = append(cmds, s.iptables("-A "+s.chain+" "+rule))
+
+	if err := runNetCommand(node.host, strings.Join(cmds, " && ")); err != nil {
+		return err
+	}
+
+	if !found {
+		s.next++
+	}
+
+	s.classes[node.alias] = class
+	s.rules[node.alias] = rule
+	s.hosts[node.host.HostID()] = node.host
+
+	return nil
+}
+
+// netShaperRule classifies the packets of node by the cgroup of its container;
+// htb uses the priority of packet as class, which is set by CLASSIFY.
+func netShaperRule(cgroup string, class int) string {
+	return fmt.Sprintf("-m cgroup --path %s -j CLASSIFY --set-class %s:%x", cgroup, netShaperHandle, class)
+}
+
+// restore removes the netem of node.
+func (s *netShaper) restore(node netNode) error {
+	s.Lock()
+	defer s.Unlock()
+
+	class, found := s.classes[node.alias]
+	if !found {
+		return nil
+	}
+
+	return runNetCommand(node.host, fmt.Sprintf("for dev in %s; do %s || exit 1; done",
+		netShaperDevices,
+		s.tc(fmt.Sprintf("qdisc replace dev $dev parent %s:%x handle %x: pfifo", netShaperHandle, class, class)),
+	))
+}
+
+// clean removes the qdisc and the rules of contest from the hosts.
+func (s *netShaper) clean() error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, id := range sortedHostIDs(s.hosts) {
+		if err := runNetCommand(s.hosts[id], fmt.Sprintf(`for dev in %s; do (%s | grep -q "htb %s:") && %s; done; %s; true`,
+			netShaperDevices,
+			s.tc("qdisc show dev $dev"), netShaperHandle,
+			s.tc("qdisc del dev $dev root"),
+			strings.Join([]string{
+				s.iptables("-D OUTPUT -j " + s.chain),
+				s.iptables("-F " + s.chain),
+				s.iptables("-X " + s.chain),
+			}, "; "),
+		)); err != nil {
+			return err
+		}
+
+		delete(s.hosts, id)
+	}
+
+	s.classes = map[string]int{}
+	s.rules = map[string]string{}
+
+	return nil
+}
+
+// netemArgs returns the netem arguments from the properties, `delay`, `jitter`,
+// `loss` and `duplicate`.
+func netemArgs(properties map[string]interface{}) (string, error) {
+	var args []string
+
+	var delay, jitter time.Duration
+
+	for k, d := range map[string]*time.Duration{"delay": &delay, "jitter": &jitter} {
+		var v string
+
+		switch found, err := actionPropertyYAML(properties, k, &v); {
+		case err != nil:
+			return "", err
+		case !found:
+			continue
+		}
+
+		i, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return "", errors.WithMessagef(err, "%s", k)
+		}
+
+		*d = i
+	}
+
+	switch {
+	case jitter > 0 && delay < 1:
+		return "", errors.Errorf("jitter needs delay")
+	case delay > 0:
+		args = append(args, fmt.Sprintf("delay %dus", delay.Microseconds()))
+
+		if jitter > 0 {
+			args = append(args, fmt.Sprintf("%dus", jitter.Microseconds()))
+		}
+	}
+
+	for _, k := range []string{"loss", "duplicate"} {
+		var v string
+
+		switch found, err := actionPropertyYAML(properties, k, &v); {
+		case err != nil:
+			return "", err
+		case !found:
+			continue
+		}
+
+		f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64)
+		if err != nil || f < 0 || f > 100 {
+			return "", errors.Errorf("%s should be percent, %q", k, v)
+		}
+
+		args = append(args, fmt.Sprintf("%s %g%%", k, f))
+	}
+
+	if len(args) < 1 {
+		return "", errors.Errorf("empty netem; delay, jitter, loss or duplicate")
+	}
+
+	return "netem " + strings.Join(args, " "), nil
+}
+
+type netNode struct {
+	host   contest.Host
+	alias  string
+	port   string
+	cgroup string
+}
+
+// netNodes returns the hosts, ports and cgroups of nodes; the port should be
+// already assigned by freePort with `node-<alias>` in the node design.
+func (cmd *runCommand) netNodes(ctx context.Context, aliases []string) ([]netNode, error) {
+	nodes := make([]netNode, len(aliases))
+
+	for i := range aliases {
+		alias := aliases[i]
+
+		host := cmd.hosts.HostByContainer(containerName(alias))
+		if host == nil {
+			return nil, errors.Errorf("host not found; %q", alias)
+		}
+
+		port, found := host.Port("node-" + alias)
+		if !found {
+			return nil, errors.Errorf("node port not assigned; freePort with %q not found in design", "node-"+alias)
+		}
+
+		cgroup, err := containerCgroup(ctx, host, containerName(alias))
+		if err != nil {
+			return nil, errors.WithMessage(err, alias)
+		}
+
+		nodes[i] = netNode{alias: alias, host: host, port: port, cgroup: cgroup}
+	}
+
+	return nodes, nil
+}
+
+// containerCgroup returns the cgroup v2 path of the running container. The
+// nodes share the network of host and dial from the ephemeral ports, so the
+// packets of node are matched by the cgroup of its socket, not by the port.
+func containerCgroup(ctx context.Context, host contest.Host, name string) (string, error) {
+	switch cid, info, found, err := host.ExistsContainer(ctx, name); {
+	case err != nil:
+		return "", err //nolint:wrapcheck //...
+	case !found, info != "running" && info != "paused":
+		return "", errors.Errorf("container not running")
+	default:
+		stdout, stderr, ok, err := host.RunCommand(fmt.Sprintf(
+			`test -f /sys/fs/cgroup/cgroup.controllers && find /sys/fs/cgroup -maxdepth 6 -type d -name "*%s*" | head -n 1`,
+			cid,
+		))
+
+		switch {
+		case err != nil:
+			return "", errors.WithStack(err)
+		case !ok:
+			return "", errors.Errorf("cgroup v2 not found in host, %q; %s", host.Address(), strings.TrimSpace(stderr))
+		}
+
+		p := strings.TrimPrefix(strings.TrimSpace(stdout), "/sys/fs/cgroup")
+		if len(p) < 1 {
+			return "", errors.Errorf("cgroup of container not found")
+		}
+
+		return p, nil
+	}
+}
+
+// partition drops the packets between the nodes of different groups. The
+// previous partition is replaced. The rules refer to the running containers, so
+// the partition should be set again after the nodes are restarted.
+func (cmd *runCommand) partition(ctx context.Context, properties map[string]interface{}) error {
+	e := util.StringError("partition")
+
+	var groups [][]string
+
+	switch found, err := actionPropertyYAML(properties, "groups", &groups); {
+	case err != nil:
+		return e.Wrap(err)
+	case !found, len(groups) < 2: //nolint:mnd //...
+		return e.Errorf("groups should have at least 2 groups")
+	}
+
+	network := "udp"
+
+	if _, err := actionPropertyYAML(properties, "network", &network); err != nil {
+		return e.Wrap(err)
+	}
+
+	var all []string
+
+	for i := range groups {
+		if len(groups[i]) < 1 {
+			return e.Errorf("empty group, %d", i)
+		}
+
+		all = append(all, groups[i]...)
+	}
+
+	if util.IsDuplicatedSlice(all, func(i string) (bool, string) { return true, i }) {
+		return e.Errorf("duplicated nodes found in groups")
+	}
+
+	nodesgroups := make([][]netNode, len(groups))
+
+	for i := range groups {
+		nodes, err := cmd.netNodes(ctx, groups[i])
+		if err != nil {
+			return e.Wrap(err)
+		}
+
+		nodesgroups[i] = nodes
+	}
+
+	hosts := map[string]contest.Host{}
+	rules := map[string][]string{}
+
+	for i := range nodesgroups {
+		for j := range nodesgroups {
+			if i == j {
+				continue
+			}
+
+			for _, from := range nodesgroups[i] {
+				for _, to := range nodesgroups[j] {
+					id := from.host.HostID()
+
+					var dst string
+					if id != to.host.HostID() {
+						dst = to.host.PublishHost()
+					}
+
+					hosts[id] = from.host
+					rules[id] = append(rules[id], partitionRule(network, from.cgroup, dst, to.port))
+				}
+			}
+		}
+	}
+
+	log.Debug().Interface("groups", groups).Interface("rules", rules).Msg("partition")
+
+	return e.Wrap(cmd.netfilter.set(hosts, rules))
+}
+
+// partitionRule drops the packets, which the node in cgroup sends to the port
+// of dst; empty dst is the same host. The rule is set in the host of sender;
+// the source port is not matched, because the dialing node uses the ephemeral
+// port.
+func partitionRule(network, cgroup, dst, port string) string {
+	d := "-m addrtype --dst-type LOCAL"
+	if len(dst) > 0 {
+		d = "-d " + dst
+	}
+
+	return fmt.Sprintf("-m cgroup --path %s -p %s %s --dport %s -j DROP", cgroup, network, d, port)
+}
+
+// actionPropertyYAML sets the property to v through yaml; the string property
+// is parsed as yaml.
+func actionPropertyYAML[T any](properties map[string]interface{}, k string, v *T) (bool, error) {
+	i, found := properties[k]
+	if !found {
+		return false, nil
+	}
+
+	var b []byte
+
+	switch t := i.(type) {
+	case string:
+		b = []byte(t)
+	default:
+		j, err := yaml.Marshal(t)
+		if err != nil {
+			return true, errors.WithStack(err)
+		}
+
+		b = j
+	}
+
+	if err := yaml.Unmarshal(b, v); err != nil {
+		return true, errors.WithMessagef(err, "property, %q", k)
+	}
+
+	return true, nil
+}
+
+// sortedHostIDs returns the sorted host ids.
+func sortedHostIDs(m map[string]contest.Host) []string {
+	ids := make([]string, 0, len(m))
+
+	for id := range m {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
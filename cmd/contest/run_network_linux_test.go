@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type testPartitionRule struct {
+	suite.Suite
+	cgroup string
+}
+
+func (t *testPartitionRule) SetupSuite() {
+	if os.Getuid() != 0 {
+		t.T().Skip("root needed")
+	}
+
+	if _, err := exec.LookPath("iptables"); err != nil {
+		t.T().Skip("iptables not found")
+	}
+
+	t.cgroup = selfCgroup()
+	if len(t.cgroup) < 1 {
+		t.T().Skip("cgroup v2 not found")
+	}
+}
+
+// unshare moves the current goroutine into the new network namespace. The
+// locked thread is not unlocked, so it is dropped with the namespace when the
+// test goroutine exits.
+func (t *testPartitionRule) unshare() {
+	runtime.LockOSThread()
+
+	if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
+		t.T().Skip("unshare network namespace:", err)
+	}
+
+	t.run("ip link set lo up")
+}
+
+func (t *testPartitionRule) run(s string) {
+	b, err := exec.Command("sh", "-c", s).CombinedOutput() //nolint:gosec //...
+	t.Require().NoError(err, "%s: %s", s, string(b))
+}
+
+func (t *testPartitionRule) listen() (*net.UDPConn, string) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	t.Require().NoError(err)
+
+	return l, strconv.Itoa(l.LocalAddr().(*net.UDPAddr).Port) //nolint:forcetypeassert //...
+}
+
+// received sends from the ephemeral port and checks whether l receives.
+func (t *testPartitionRule) received(l *net.UDPConn) bool {
+	c, err := net.DialUDP("udp", nil, l.LocalAddr().(*net.UDPAddr)) //nolint:forcetypeassert //...
+	t.Require().NoError(err)
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	t.NotEqual(l.LocalAddr().(*net.UDPAddr).Port, c.LocalAddr().(*net.UDPAddr).Port) //nolint:forcetypeassert //...
+
+	_, _ = c.Write([]byte("ping"))
+
+	t.Require().NoError(l.SetReadDeadline(time.Now().Add(time.Millisecond * 300)))
+
+	_, _, err = l.ReadFromUDP(make([]byte, 8))
+
+	return err == nil
+}
+
+func (t *testPartitionRule) TestDropEphemeralSourcePort() {
+	for name, dst := range map[string]string{"same host": "", "other host": "127.0.0.1"} {
+		t.Run(name, func() {
+			t.unshare()
+
+			to, port := t.listen()
+			defer to.Close()
+
+			other, _ := t.listen()
+			defer other.Close()
+
+			t.True(t.received(to))
+
+			t.run("iptables -N contest-test && iptables -I OUTPUT -j contest-test")
+			t.run("iptables -A contest-test " + partitionRule("udp", t.cgroup, dst, port))
+
+			t.False(t.received(to), "not dropped")
+			t.True(t.received(other), "other port dropped")
+
+			t.run("iptables -F contest-test")
+
+			t.True(t.received(to))
+		})
+	}
+}
+
+func selfCgroup() string {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	sc := bufio.NewScanner(f)
+
+	for sc.Scan() {
+		if p, found := strings.CutPrefix(sc.Text(), "0::"); found {
+			return p
+		}
+	}
+
+	return ""
+}
+
+func TestPartitionRule(t *testing.T) {
+	suite.Run(t, new(testPartitionRule))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spikeekips/contest"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestNetemArgs(tt *testing.T) {
+	t := new(suite.Suite)
+	t.SetT(tt)
+
+	cases := []struct {
+		name       string
+		properties map[string]interface{}
+		netem      string
+		err        string
+	}{
+		{name: "delay", properties: map[string]interface{}{"delay": "100ms"}, netem: "netem delay 100000us"},
+		{
+			name:       "delay and jitter",
+			properties: map[string]interface{}{"delay": "100ms", "jitter": " 10ms "},
+			netem:      "netem delay 100000us 10000us",
+		},
+		{name: "loss", properties: map[string]interface{}{"loss": "10%"}, netem: "netem loss 10%"},
+		{name: "loss without percent", properties: map[string]interface{}{"loss": "0.5"}, netem: "netem loss 0.5%"},
+		{
+			name:       "all",
+			properties: map[string]interface{}{"delay": "1s", "jitter": "1ms", "loss": "1%", "duplicate": "2%"},
+			netem:      "netem delay 1000000us 1000us loss 1% duplicate 2%",
+		},
+		{name: "empty", properties: map[string]interface{}{}, err: "empty netem"},
+		{name: "jitter without delay", properties: map[string]interface{}{"jitter": "10ms"}, err: "jitter needs delay"},
+		{name: "wrong delay", properties: map[string]interface{}{"delay": "100"}, err: "delay"},
+		{name: "over 100 percent", properties: map[string]interface{}{"loss": "101%"}, err: "loss should be percent"},
+		{name: "under zero percent", properties: map[string]interface{}{"duplicate": "-1"}, err: "duplicate should be percent"},
+	}
+
+	for i, c := range cases {
+		t.Run(c.name, func() {
+			netem, err := netemArgs(c.properties)
+			if len(c.err) > 0 {
+				t.Error(err, "%d: %v", i, c.name)
+				t.ErrorContains(err, c.err, "%d: %v", i, c.name)
+
+				return
+			}
+
+			t.NoError(err, "%d: %v", i, c.name)
+			t.Equal(c.netem, netem, "%d: %v", i, c.name)
+		})
+	}
+}
+
+func TestNetShaperRule(tt *testing.T) {
+	t := new(suite.Suite)
+	t.SetT(tt)
+
+	cases := []struct {
+		name   string
+		cgroup string
+		rule   string
+		class  int
+	}{
+		{
+			name:   "first",
+			cgroup: "/system.slice/docker-a.scope",
+			class:  0x10,
+			rule:   "-m cgroup --path /system.slice/docker-a.scope -j CLASSIFY --set-class 1f00:10",
+		},
+		{
+			name:   "hex",
+			cgroup: "/docker/b",
+			class:  0x1a,
+			rule:   "-m cgroup --path /docker/b -j CLASSIFY --set-class 1f00:1a",
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(c.name, func() {
+			t.Equal(c.rule, netShaperRule(c.cgroup, c.class), "%d: %v", i, c.name)
+		})
+	}
+}
+
+type testNetShaperHost struct {
+	contest.Host
+	cmds []string
+	fail bool
+}
+
+func (*testNetShaperHost) HostID() string {
+	return "host0"
+}
+
+func (*testNetShaperHost) Address() string {
+	return "host0"
+}
+
+func (h *testNetShaperHost) RunCommand(s string) (stdout, stderr string, ok bool, err error) {
+	h.cmds = append(h.cmds, s)
+
+	return "", "", !h.fail, nil
+}
+
+func TestNetShaperApply(tt *testing.T) {
+	t := new(suite.Suite)
+	t.SetT(tt)
+
+	if log == nil {
+		l := zerolog.Nop()
+		log = &l
+
+		t.T().Cleanup(func() {
+			log = nil
+		})
+	}
+
+	s := newNetShaper("contest-test", "")
+	host := &testNetShaperHost{fail: true}
+	no0 := netNode{host: host, alias: "no0", cgroup: "/docker/no0"}
+	no1 := netNode{host: host, alias: "no1", cgroup: "/docker/no1"}
+
+	t.Run("failed", func() {
+		t.Error(s.apply(no0, "netem delay 1000us"))
+		t.Equal(0x10, s.next)
+		t.Empty(s.classes)
+		t.Empty(s.rules)
+	})
+
+	host.fail = false
+
+	t.Run("apply", func() {
+		t.NoError(s.apply(no0, "netem delay 1000us"))
+		t.Equal(0x11, s.next)
+		t.Equal(0x10, s.classes["no0"])
+		t.Equal(netShaperRule("/docker/no0", 0x10), s.rules["no0"])
+		t.Contains(host.cmds[len(host.cmds)-1], "qdisc replace dev $dev parent 1f00:10 handle 10: netem delay 1000us")
+	})
+
+	t.Run("replace", func() {
+		t.NoError(s.apply(no0, "netem loss 1%"))
+		t.Equal(0x11, s.next)
+		t.Equal(0x10, s.classes["no0"])
+
+		cmd := host.cmds[len(host.cmds)-1]
+		t.Contains(cmd, "-D "+s.chain+" "+netShaperRule("/docker/no0", 0x10))
+		t.True(strings.HasSuffix(cmd, "-A "+s.chain+" "+netShaperRule("/docker/no0", 0x10)))
+	})
+
+	t.Run("next node", func() {
+		t.NoError(s.apply(no1, "netem loss 1%"))
+		t.Equal(0x12, s.next)
+		t.Equal(0x11, s.classes["no1"])
+	})
+}
@@ -17,11 +17,15 @@ import (
 	"github.com/spikeekips/contest"
 	"github.com/spikeekips/mitum/util"
 	"github.com/spikeekips/mitum/util/logging"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 	"gopkg.in/yaml.v3"
 )
 
 var DefaultHostBase = "/tmp/contest"
 
+var varsFile = "vars.json"
+
 func (cmd *runCommand) prepare(ctx context.Context) error {
 	if err := cmd.prepareFlags(); err != nil {
 		return err
@@ -31,8 +35,10 @@ func (cmd *runCommand) prepare(ctx context.Context) error {
 		return err
 	}
 
-	if err := cmd.ferretDB(ctx); err != nil {
-		return err
+	if cmd.LogStore == "ferretdb" {
+		if err := cmd.ferretDB(ctx); err != nil {
+			return err
+		}
 	}
 
 	if err := cmd.prepareLogs(); err != nil {
@@ -53,10 +59,18 @@ func (cmd *runCommand) prepare(ctx context.Context) error {
 
 	log.Debug().Interface("vars", cmd.vars.Map()).Msg("vars")
 
+	if err := cmd.saveVars(); err != nil {
+		log.Error().Err(err).Msg("failed to save vars")
+	}
+
 	return nil
 }
 
 func (cmd *runCommand) prepareFlags() error {
+	if len(cmd.id) < 1 {
+		cmd.id = util.ULID().String()
+	}
+
 	if len(cmd.NodeBinaries) < 1 {
 		return errors.Errorf("empty node binaries")
 	}
@@ -84,8 +98,21 @@ func (cmd *runCommand) prepareFlags() error {
 		return errors.Errorf("empty host")
 	}
 
+	for i := range cmd.Reports {
+		if _, found := reportFiles[cmd.Reports[i]]; !found {
+			return errors.Errorf("unknown report format, %q", cmd.Reports[i])
+		}
+	}
+
+	switch {
+	case len(cmd.MongodbURI) > 0 && cmd.LogStore == "ferretdb":
+		cmd.LogStore = "mongodb"
+	case len(cmd.MongodbURI) < 1 && cmd.LogStore == "mongodb":
+		return errors.Errorf("empty --mongodb for mongodb log store")
+	}
+
 	log.Debug().
-		Str("id", contestID).
+		Str("id", cmd.id).
 		Str("basedir", cmd.BaseDir).
 		Func(func(e *zerolog.Event) {
 			for i := range cmd.Hosts {
@@ -95,9 +122,11 @@ func (cmd *runCommand) prepareFlags() error {
 		Str("design", cmd.Design).
 		Interface("hosts", cmd.Hosts).
 		Strs("node_binaries", cmd.NodeBinaries).
+		Str("log_store", cmd.LogStore).
 		Str("mongodb", cmd.mongodb).
 		Dur("timeout", cmd.Timeout).
 		Uint("pprof_seconds", cmd.PprofSeconds).
+		Strs("reports", cmd.Reports).
 		Msg("flags")
 
 	return nil
@@ -171,7 +200,21 @@ func (cmd *runCommand) prepareHosts() error {
 		}
 
 		if err := worker.NewJob(func(context.Context, uint64) error {
-			return cmd.checkImages(host.Client(), DefaultNodeImage, DefaultRedisImage)
+			if cmd.prepared != nil {
+				if _, found := cmd.prepared.images.Value(host.Address()); found {
+					return nil
+				}
+			}
+
+			if err := cmd.checkImages(host.Client(), DefaultNodeImage, DefaultRedisImage); err != nil {
+				return err
+			}
+
+			if cmd.prepared != nil {
+				_ = cmd.prepared.images.SetValue(host.Address(), true)
+			}
+
+			return nil
 		}); err != nil {
 			return false, err
 		}
@@ -191,6 +234,14 @@ func (cmd *runCommand) prepareBinaries(host contest.Host) error {
 			contest.MachineToString(host.Arch()))
 	}
 
+	if cmd.prepared != nil {
+		if source, found := cmd.prepared.binaries.Value(host.Address()); found {
+			if err := host.Link(source, "cmd", "cmd"); err == nil {
+				return nil
+			}
+		}
+	}
+
 	f, err := os.Open(i)
 	if err != nil {
 		return errors.WithStack(err)
@@ -204,6 +255,12 @@ func (cmd *runCommand) prepareBinaries(host contest.Host) error {
 		return errors.WithMessage(err, "upload node binary")
 	}
 
+	if cmd.prepared != nil {
+		path, _ := host.File("cmd")
+
+		_ = cmd.prepared.binaries.SetValue(host.Address(), path)
+	}
+
 	return nil
 }
 
@@ -255,12 +312,40 @@ func (cmd *runCommand) prepareBase() error {
 }
 
 func (cmd *runCommand) prepareLogs() error {
-	db, err := contest.NewMongodbFromURI(context.Background(), cmd.mongodb)
-	if err != nil {
-		return errors.WithStack(err)
-	}
+	switch cmd.LogStore {
+	case "memory":
+		log.Warn().Msg("logs are kept in memory; they are not available after contest")
+
+		cmd.db = contest.NewMemoryLogStore()
+	case "mongodb":
+		cs, err := connstring.Parse(cmd.MongodbURI)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		database := cs.Database
+		if len(database) < 1 {
+			database = "contest"
+		}
+
+		database += "_" + strings.ToLower(cmd.id)
+
+		db, err := contest.NewMongodbFromURIWithDatabase(context.Background(), cmd.MongodbURI, database)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		log.Debug().Str("database", database).Msg("external mongodb connected")
 
-	cmd.db = db
+		cmd.db = db
+	default:
+		db, err := contest.NewMongodbFromURI(context.Background(), cmd.mongodb)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		cmd.db = db
+	}
 
 	return nil
 }
@@ -268,35 +353,77 @@ func (cmd *runCommand) prepareLogs() error {
 func (cmd *runCommand) prepareDesign() error {
 	e := util.StringError("load design")
 
-	i, err := os.ReadFile(cmd.Design)
+	vars, err := loadOverrideVars(cmd.VarFiles, cmd.Vars)
 	if err != nil {
 		return e.Wrap(err)
 	}
 
-	log.Debug().Str("content", string(i)).Msg("design")
-
-	if err := yaml.Unmarshal(i, &cmd.design); err != nil {
+	design, i, err := contest.LoadDesignFile(cmd.Design, vars...)
+	if err != nil {
 		return e.Wrap(err)
 	}
 
+	log.Debug().Str("content", string(i)).Msg("design")
+
+	cmd.design = design
+
 	if err := cmd.design.IsValid(nil); err != nil {
 		return e.Wrap(err)
 	}
 
+	if len(cmd.design.Indexes) > 0 {
+		models := make([]mongo.IndexModel, len(cmd.design.Indexes))
+
+		for i := range cmd.design.Indexes {
+			models[i] = cmd.design.Indexes[i].IndexModel()
+		}
+
+		if err := cmd.db.CreateIndexes(context.Background(), models); err != nil {
+			return e.WithMessage(err, "indexes")
+		}
+	}
+
 	return nil
 }
 
+// loadOverrideVars returns the vars from --var-file and --var; --var overrides
+// --var-file.
+func loadOverrideVars(files []string, flags []VarFlag) ([]map[string]interface{}, error) {
+	vars := make([]map[string]interface{}, len(files)+1)
+
+	for i := range files {
+		b, err := os.ReadFile(files[i])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var m map[string]interface{}
+
+		if err := yaml.Unmarshal(b, &m); err != nil {
+			return nil, errors.WithMessagef(err, "var file, %q", files[i])
+		}
+
+		vars[i] = m
+	}
+
+	m := map[string]interface{}{}
+
+	for i := range flags {
+		m[flags[i].key] = flags[i].value
+	}
+
+	vars[len(vars)-1] = m
+
+	return vars, nil
+}
+
 func (cmd *runCommand) prepareScenario() error { //revive:disable-line:cognitive-complexity,function-length,cyclomatic
 	e := util.StringError("load scenario")
 
 	log.Debug().Interface("scenario", cmd.design).Msg("scenario loaded")
 
-	vars := contest.NewVars(nil)
-
 	// NOTE global vars
-	for k := range cmd.design.Vars {
-		vars.Set(k, cmd.design.Vars[k])
-	}
+	vars := contest.NewDesignVars(cmd.design.Vars)
 
 	vars = vars.AddFunc("uuid", func() string {
 		return util.UUID().String()
@@ -470,6 +597,42 @@ func (cmd *runCommand) prepareScenario() error { //revive:disable-line:cognitive
 	return nil
 }
 
+// saveVars saves the vars before starting expects to base directory; replay
+// loads them to compile the conditions. The hosts are saved as their address.
+func (cmd *runCommand) saveVars() error {
+	b, err := util.MarshalJSONIndent(exportVars(cmd.vars.Map()))
+	if err != nil {
+		return err //nolint:wrapcheck //...
+	}
+
+	return errors.WithStack(os.WriteFile(filepath.Join(cmd.basedir, varsFile), b, 0o600))
+}
+
+func exportVars(i interface{}) interface{} {
+	switch t := i.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+
+		for k := range t {
+			m[k] = exportVars(t[k])
+		}
+
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+
+		for j := range t {
+			l[j] = exportVars(t[j])
+		}
+
+		return l
+	case contest.Host:
+		return t.Address()
+	default:
+		return t
+	}
+}
+
 func (cmd *runCommand) checkLocalPublishHost() error {
 	var locals []contest.Host
 
@@ -551,10 +714,10 @@ func (cmd *runCommand) ferretDB(ctx context.Context) error {
 
 	//nolint:godox // FIXME address.Address of go.mongodb.org/mongo-driver/mongo
 	// can not handle uppercase unix socket name.
-	sock := filepath.Join(cmd.basedir, fmt.Sprintf("%s.sock", strings.ToLower(contestID)))
+	sock := filepath.Join(cmd.basedir, fmt.Sprintf("%s.sock", strings.ToLower(cmd.id)))
 	cmd.mongodb = fmt.Sprintf("mongodb://%s/contest", url.QueryEscape(sock))
 
-	db := filepath.Join(cmd.basedir, contestID)
+	db := filepath.Join(cmd.basedir, cmd.id)
 	if err := os.MkdirAll(db, 0o700); err != nil {
 		return errors.WithStack(err)
 	}
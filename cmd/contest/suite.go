@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/mitum/util"
+)
+
+type suiteCommand struct { //nolint:govet //...
+	BaseDir   string     `arg:"" name:"base_directory" help:"base directory"`
+	Scenarios string     `arg:"" name:"scenarios" help:"scenario directory or glob pattern; files starting with _ are skipped as fragments"`
+	Hosts     []HostFlag `arg:"" name:"host" help:"docker host"`
+	runFlags  `embed:""`
+	Pools     uint `name:"pools" help:"number of disjoint host pools; scenarios run in parallel across pools" default:"1"`
+}
+
+type suiteResult struct {
+	err      error
+	name     string
+	design   string
+	duration time.Duration
+}
+
+func (cmd *suiteCommand) Run() error {
+	e := util.StringError("suite")
+
+	designs, err := cmd.designs()
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	pools, err := cmd.pools()
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	if err := os.MkdirAll(cmd.BaseDir, 0o700); err != nil {
+		return e.Wrap(err)
+	}
+
+	names, err := suiteScenarioNames(designs)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	prepared := newPreparedHosts()
+
+	results := make([]suiteResult, len(designs))
+
+	designch := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for i := range pools {
+		pool := pools[i]
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := range designch {
+				results[j] = cmd.runScenario(names[j], designs[j], pool, prepared)
+			}
+		}()
+	}
+
+	for i := range designs {
+		designch <- i
+	}
+
+	close(designch)
+
+	wg.Wait()
+
+	header := []string{"scenario", "result", "duration", "error"}
+	rows := make([][]string, len(results))
+
+	var failed int
+
+	for i := range results {
+		r := results[i]
+
+		switch {
+		case r.err == nil:
+			rows[i] = []string{r.name, "pass", r.duration.Round(time.Second).String(), ""}
+		default:
+			failed++
+
+			rows[i] = []string{r.name, "fail", r.duration.Round(time.Second).String(),
+				strings.ReplaceAll(r.err.Error(), "\n", " ")}
+		}
+	}
+
+	if err := writeSummary(filepath.Join(cmd.BaseDir, "summary.txt"), header, rows); err != nil {
+		return e.Wrap(err)
+	}
+
+	if failed > 0 {
+		return e.Errorf("%d of %d scenarios failed", failed, len(results))
+	}
+
+	return nil
+}
+
+func (cmd *suiteCommand) runScenario(name, design string, hosts []HostFlag, prepared *preparedHosts) suiteResult {
+	log.Info().Str("scenario", design).Interface("hosts", hosts).Msg("suite scenario started")
+
+	r := runCommand{
+		BaseDir:  filepath.Join(cmd.BaseDir, name),
+		Design:   design,
+		runFlags: cmd.runFlags,
+		prepared: prepared,
+	}
+
+	r.Hosts = make([]HostFlag, len(hosts))
+	copy(r.Hosts, hosts)
+
+	started := time.Now()
+
+	err := func() error {
+		defer func() {
+			if r.db != nil {
+				_ = r.db.Close(context.Background())
+			}
+		}()
+
+		return r.Run()
+	}()
+
+	result := suiteResult{name: name, design: design, err: err, duration: time.Since(started)}
+
+	log.Info().Str("scenario", design).Dur("elapsed", result.duration).Err(err).Msg("suite scenario finished")
+
+	return result
+}
+
+// designs returns the scenario files; if Scenarios is directory, the yaml
+// files in it. The files starting with `_` are the fragments for extends and
+// include, so they are skipped.
+func (cmd *suiteCommand) designs() ([]string, error) {
+	var files []string
+
+	switch fi, err := os.Stat(cmd.Scenarios); {
+	case err == nil && fi.IsDir():
+		for _, ext := range []string{"*.yml", "*.yaml"} {
+			i, err := filepath.Glob(filepath.Join(cmd.Scenarios, ext))
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			files = append(files, i...)
+		}
+	default:
+		i, err := filepath.Glob(cmd.Scenarios)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for j := range i {
+			if fi, err := os.Stat(i[j]); err == nil && !fi.IsDir() {
+				files = append(files, i[j])
+			}
+		}
+	}
+
+	files = util.FilterSlice(files, func(f string) bool {
+		return !strings.HasPrefix(filepath.Base(f), "_")
+	})
+
+	if len(files) < 1 {
+		return nil, errors.Errorf("no scenario files found, %q", cmd.Scenarios)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// pools splits the hosts into the disjoint pools.
+func (cmd *suiteCommand) pools() ([][]HostFlag, error) {
+	n := int(cmd.Pools)
+
+	switch {
+	case n < 1:
+		n = 1
+	case n > len(cmd.Hosts):
+		return nil, errors.Errorf("not enough hosts for %d pools, %d hosts", n, len(cmd.Hosts))
+	}
+
+	if n > 1 {
+		addrs := map[string]struct{}{}
+
+		for i := range cmd.Hosts {
+			h := cmd.Hosts[i]
+
+			addr := h.host
+			if h.dockerhost != nil {
+				addr = h.dockerhost.String()
+			}
+
+			if _, found := addrs[addr]; found {
+				return nil, errors.Errorf("duplicated host in pools, %q", addr)
+			}
+
+			addrs[addr] = struct{}{}
+		}
+	}
+
+	pools := make([][]HostFlag, n)
+
+	for i := range cmd.Hosts {
+		pools[i%n] = append(pools[i%n], cmd.Hosts[i])
+	}
+
+	return pools, nil
+}
+
+func suiteScenarioNames(designs []string) ([]string, error) {
+	names := make([]string, len(designs))
+	found := map[string]struct{}{}
+
+	for i := range designs {
+		name := strings.TrimSuffix(filepath.Base(designs[i]), filepath.Ext(designs[i]))
+
+		if _, ok := found[name]; ok {
+			return nil, errors.Errorf("duplicated scenario name, %q", fmt.Sprintf("%s(%s)", name, designs[i]))
+		}
+
+		found[name] = struct{}{}
+		names[i] = name
+	}
+
+	return names, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// writeSummary prints the summary table to stdout and saves it to file.
+func writeSummary(f string, header []string, rows [][]string) error {
+	of, err := os.Create(f)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() {
+		_ = of.Close()
+	}()
+
+	return printSummary(io.MultiWriter(os.Stdout, of), header, rows)
+}
+
+func printSummary(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:mnd //...
+
+	if _, err := fmt.Fprintln(tw, strings.Join(header, "\t")); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for i := range rows {
+		if _, err := fmt.Fprintln(tw, strings.Join(rows[i], "\t")); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.WithStack(tw.Flush())
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spikeekips/contest"
+	"github.com/spikeekips/mitum/util"
+)
+
+type sweepCommand struct { //nolint:govet //...
+	runCommand `embed:""`
+	Matrix     []MatrixFlag `name:"matrix" sep:"none" help:"matrix values, <key>=<value>,<value>..; overrides matrix of scenario"`
+}
+
+func (cmd *sweepCommand) Run() error {
+	e := util.StringError("sweep")
+
+	matrix, err := cmd.matrix()
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	combs := matrix.Combinations()
+	if len(combs) < 1 {
+		return e.Errorf("empty matrix")
+	}
+
+	if err := os.MkdirAll(cmd.BaseDir, 0o700); err != nil {
+		return e.Wrap(err)
+	}
+
+	keys := matrix.Keys()
+
+	cmd.prepared = newPreparedHosts()
+
+	header := append(append([]string{"#"}, keys...), "result", "duration", "error") //nolint:gocritic //...
+	rows := make([][]string, len(combs))
+
+	var failed int
+
+	for i := range combs {
+		log.Info().Int("index", i).Interface("vars", combs[i]).Msg("sweep combination started")
+
+		started := time.Now()
+
+		err := cmd.runCombination(i, keys, combs[i])
+
+		elapsed := time.Since(started)
+
+		log.Info().Int("index", i).Interface("vars", combs[i]).Dur("elapsed", elapsed).Err(err).
+			Msg("sweep combination finished")
+
+		row := []string{cmd.combinationName(i)}
+
+		for j := range keys {
+			row = append(row, fmt.Sprintf("%v", combs[i][keys[j]]))
+		}
+
+		switch {
+		case err == nil:
+			row = append(row, "pass", elapsed.Round(time.Second).String(), "")
+		default:
+			failed++
+
+			row = append(row, "fail", elapsed.Round(time.Second).String(),
+				strings.ReplaceAll(err.Error(), "\n", " "))
+		}
+
+		rows[i] = row
+	}
+
+	if err := writeSummary(filepath.Join(cmd.BaseDir, "summary.txt"), header, rows); err != nil {
+		return e.Wrap(err)
+	}
+
+	if failed > 0 {
+		return e.Errorf("%d of %d combinations failed", failed, len(combs))
+	}
+
+	return nil
+}
+
+func (cmd *sweepCommand) matrix() (contest.DesignMatrix, error) {
+	matrix, err := contest.LoadDesignMatrix(cmd.Design)
+	if err != nil {
+		return nil, err //nolint:wrapcheck //...
+	}
+
+	if matrix == nil {
+		matrix = contest.DesignMatrix{}
+	}
+
+	for i := range cmd.Matrix {
+		matrix[cmd.Matrix[i].key] = cmd.Matrix[i].values
+	}
+
+	if err := matrix.IsValid(nil); err != nil {
+		return nil, err //nolint:wrapcheck //...
+	}
+
+	return matrix, nil
+}
+
+func (cmd *sweepCommand) runCombination(index int, keys []string, comb map[string]interface{}) error {
+	r := cmd.runCommand
+
+	r.BaseDir = filepath.Join(cmd.BaseDir, cmd.combinationName(index))
+
+	r.Hosts = make([]HostFlag, len(cmd.Hosts))
+	copy(r.Hosts, cmd.Hosts)
+
+	// NOTE matrix vars override --var
+	r.Vars = make([]VarFlag, len(cmd.Vars), len(cmd.Vars)+len(keys))
+	copy(r.Vars, cmd.Vars)
+
+	for i := range keys {
+		r.Vars = append(r.Vars, VarFlag{key: keys[i], value: comb[keys[i]]})
+	}
+
+	defer func() {
+		if r.db != nil {
+			_ = r.db.Close(context.Background())
+		}
+	}()
+
+	return r.Run()
+}
+
+func (*sweepCommand) combinationName(index int) string {
+	return fmt.Sprintf("%03d", index)
+}
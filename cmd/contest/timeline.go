@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/contest"
+	"github.com/spikeekips/mitum/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type reportCommand struct {
+	BaseDir string `arg:"" name:"base_directory" help:"base directory of contest" type:"existingdir"`
+	Output  string `name:"output" help:"html file; default is <base_directory>/timeline.html"`
+}
+
+type timelineEvent struct {
+	T      time.Time
+	Lane   string
+	Kind   string
+	Label  string
+	Detail string
+	Left   float64
+}
+
+type timelineLane struct {
+	Name   string
+	Events []timelineEvent
+}
+
+func (cmd *reportCommand) Run() error {
+	e := util.StringError("report")
+
+	db, closef, err := openContestDB(cmd.BaseDir)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	defer closef()
+
+	var events []timelineEvent
+
+	if err := db.Traverse(context.Background(), bson.M{}, nil, func(record map[string]interface{}) (bool, error) {
+		if ev, ok := newTimelineEvent(record); ok {
+			events = append(events, ev)
+		}
+
+		return true, nil
+	}); err != nil {
+		return e.Wrap(err)
+	}
+
+	report, found, err := loadContestReport(cmd.BaseDir)
+
+	switch {
+	case err != nil:
+		return e.Wrap(err)
+	case found:
+		events = append(events, expectTimelineEvents(report.Expects)...)
+	default:
+		log.Warn().Msg("report.json not found; expect results are not shown")
+	}
+
+	output := cmd.Output
+	if len(output) < 1 {
+		output = filepath.Join(cmd.BaseDir, "timeline.html")
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return e.Wrap(err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if err := renderTimeline(f, report, events); err != nil {
+		return e.Wrap(err)
+	}
+
+	log.Info().Str("output", output).Int("events", len(events)).Msg("timeline report written")
+
+	return nil
+}
+
+func loadContestReport(basedir string) (r contestReport, found bool, _ error) {
+	b, err := os.ReadFile(filepath.Join(basedir, reportFiles["json"]))
+
+	switch {
+	case os.IsNotExist(err):
+		return r, false, nil
+	case err != nil:
+		return r, false, errors.WithStack(err)
+	}
+
+	if err := json.Unmarshal(b, &r); err != nil {
+		return r, false, errors.WithStack(err)
+	}
+
+	return r, true, nil
+}
+
+// newTimelineEvent picks the events of nodes, like state switches, blocks
+// saved, ballots voted and container exits.
+func newTimelineEvent(record map[string]interface{}) (ev timelineEvent, _ bool) {
+	t, ok := recordTime(record)
+	if !ok {
+		return ev, false
+	}
+
+	ev.T = t
+
+	node, _ := record["node"].(string)
+	if len(node) < 1 { // NOTE internal log entry
+		if _, found := recordValue(record, "x.expect"); found {
+			return ev, false // NOTE expect events are drawn from report
+		}
+
+		msg, _ := record["msg"].(string)
+
+		ev.Lane = "contest"
+		ev.Kind = "contest"
+		ev.Label = msg
+
+		if i, found := record["error"]; found && i != nil {
+			ev.Kind = "exit"
+			ev.Detail = fmt.Sprintf("%v", i)
+		}
+
+		return ev, len(msg) > 0
+	}
+
+	ev.Lane = node
+
+	x, _ := recordValue(record, "x")
+
+	switch msg, _ := recordValue(x, "message"); msg {
+	case "state switched":
+		next, _ := recordValue(x, "next_state.next")
+
+		ev.Kind = "state"
+		ev.Label = fmt.Sprintf("state: %v", next)
+	case "new block saved":
+		height, _ := recordValue(x, "height")
+
+		ev.Kind = "block"
+		ev.Label = fmt.Sprintf("block: %v", height)
+	case "ballot voted":
+		height, _ := recordValue(x, "sign_fact.fact.point.height")
+		round, _ := recordValue(x, "sign_fact.fact.point.round")
+		stage, _ := recordValue(x, "sign_fact.fact.point.stage")
+
+		ev.Kind = "ballot"
+		ev.Label = fmt.Sprintf("ballot: %v/%v/%v", height, round, stage)
+	default:
+		container, found := recordValue(x, "container")
+		if !found {
+			return ev, false
+		}
+
+		code, _ := recordValue(x, "exit_code")
+		err, _ := recordValue(x, "error")
+
+		ev.Kind = "exit"
+		ev.Label = fmt.Sprintf("exit: %v", code)
+		ev.Detail = fmt.Sprintf("container=%v error=%v", container, err)
+	}
+
+	return ev, true
+}
+
+func expectTimelineEvents(results []contest.ExpectResult) []timelineEvent {
+	var events []timelineEvent
+
+	for i := range results {
+		r := results[i]
+
+		if !r.Finished.IsZero() {
+			name := r.Condition
+			if len(r.Label) > 0 {
+				name = r.Label
+			}
+
+			events = append(events, timelineEvent{
+				T:      r.Finished,
+				Lane:   "expects",
+				Kind:   "expect-" + string(r.Status),
+				Label:  fmt.Sprintf("expect #%s %s", r.Path, r.Status),
+				Detail: strings.Join(strings.Fields(name), " "),
+			})
+		}
+
+		for j := range r.Actions {
+			a := r.Actions[j]
+
+			detail := fmt.Sprintf("expect #%s %s", r.Path, a.Trigger)
+			if len(a.Error) > 0 {
+				detail += "; error=" + a.Error
+			}
+
+			events = append(events, timelineEvent{
+				T:      a.Time,
+				Lane:   "actions",
+				Kind:   "action",
+				Label:  a.Type + " " + strings.Join(a.Args, " "),
+				Detail: detail,
+			})
+		}
+	}
+
+	return events
+}
+
+// recordValue returns the value of record by dotted keys.
+func recordValue(record interface{}, keys string) (interface{}, bool) {
+	v := record
+
+	for _, k := range strings.Split(keys, ".") {
+		var m map[string]interface{}
+
+		switch t := v.(type) {
+		case map[string]interface{}:
+			m = t
+		case primitive.M:
+			m = t
+		default:
+			return nil, false
+		}
+
+		i, found := m[k]
+		if !found {
+			return nil, false
+		}
+
+		v = i
+	}
+
+	return v, true
+}
+
+func timelineLanes(events []timelineEvent) (lanes []timelineLane, start, end time.Time) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].T.Before(events[j].T)
+	})
+
+	if len(events) > 0 {
+		start, end = events[0].T, events[len(events)-1].T
+	}
+
+	d := end.Sub(start)
+
+	m := map[string][]timelineEvent{}
+
+	for i := range events {
+		ev := events[i]
+
+		if d > 0 {
+			ev.Left = float64(ev.T.Sub(start)) / float64(d) * 100 //nolint:mnd //...
+		}
+
+		m[ev.Lane] = append(m[ev.Lane], ev)
+	}
+
+	var nodes []string
+
+	for lane := range m {
+		switch lane {
+		case "contest", "expects", "actions":
+		default:
+			nodes = append(nodes, lane)
+		}
+	}
+
+	sort.Strings(nodes)
+
+	for _, lane := range append([]string{"contest", "expects", "actions"}, nodes...) {
+		if l, found := m[lane]; found {
+			lanes = append(lanes, timelineLane{Name: lane, Events: l})
+		}
+	}
+
+	return lanes, start, end
+}
+
+func renderTimeline(f *os.File, report contestReport, events []timelineEvent) error {
+	lanes, start, end := timelineLanes(events)
+
+	t, err := template.New("timeline").Funcs(template.FuncMap{
+		"since": func(t time.Time) string {
+			return t.Sub(start).Round(time.Millisecond).String()
+		},
+		"left": func(f float64) template.CSS {
+			return template.CSS(fmt.Sprintf("left: %.3f%%", f))
+		},
+	}).Parse(timelineTemplate)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(t.Execute(f, map[string]interface{}{
+		"report":   report,
+		"lanes":    lanes,
+		"events":   events,
+		"start":    start,
+		"end":      end,
+		"duration": end.Sub(start).Round(time.Millisecond).String(),
+		"kinds": []string{
+			"state", "block", "ballot", "exit", "contest", "action", "expect-matched", "expect-failed",
+		},
+	}))
+}
+
+var timelineTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>contest {{ .report.ID }}</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; margin: 20px; }
+.lane { display: flex; align-items: center; border-bottom: 1px solid #eee; height: 28px; }
+.lane .name { width: 100px; font-weight: bold; }
+.lane .events { position: relative; flex: 1; height: 100%; }
+.ev { position: absolute; top: 8px; width: 10px; height: 10px; border-radius: 5px; margin-left: -5px; }
+.state { background: #1f77b4; }
+.block { background: #2ca02c; }
+.ballot { background: #bcbd22; }
+.exit { background: #d62728; }
+.contest { background: #7f7f7f; }
+.action { background: #9467bd; }
+.expect-matched { background: #17becf; }
+.expect-failed, .expect-timed_out, .expect-error { background: #ff7f0e; }
+.expect-canceled, .expect-pending { background: #c7c7c7; }
+table { border-collapse: collapse; margin-top: 20px; }
+td, th { text-align: left; padding: 2px 8px; border-bottom: 1px solid #eee; vertical-align: top; }
+.legend span { display: inline-block; margin-right: 12px; }
+.legend .ev { position: static; display: inline-block; margin: 0 4px 0 0; }
+</style>
+</head>
+<body>
+<h1>contest {{ .report.ID }}</h1>
+<p>
+scenario: {{ .report.Scenario }}<br>
+result: {{ .report.Result }} {{ .report.Error }}<br>
+from {{ .start.Format "2006-01-02T15:04:05.000Z07:00" }} to {{ .end.Format "2006-01-02T15:04:05.000Z07:00" }} ({{ .duration }})
+</p>
+<p class="legend">
+{{- range $kind := .kinds }}
+<span><i class="ev {{ $kind }}"></i>{{ $kind }}</span>
+{{- end }}
+</p>
+{{- range .lanes }}
+<div class="lane">
+<div class="name">{{ .Name }}</div>
+<div class="events">
+{{- range .Events }}
+<i class="ev {{ .Kind }}" style="{{ left .Left }}" title="+{{ since .T }} {{ .Label }} {{ .Detail }}"></i>
+{{- end }}
+</div>
+</div>
+{{- end }}
+<table>
+<tr><th>time</th><th>lane</th><th>event</th><th>detail</th></tr>
+{{- range .events }}
+<tr><td>+{{ since .T }}</td><td>{{ .Lane }}</td><td><i class="ev {{ .Kind }}" style="position: static; display: inline-block"></i> {{ .Label }}</td><td>{{ .Detail }}</td></tr>
+{{- end }}
+</table>
+</body>
+</html>
+`
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/arl/statsviz"
 	"github.com/pkg/errors"
@@ -18,6 +19,7 @@ import (
 	"github.com/spikeekips/mitum/launch"
 	"github.com/spikeekips/mitum/network/quicstream"
 	"github.com/spikeekips/mitum/util"
+	"github.com/spikeekips/mitum/util/localtime"
 	"github.com/spikeekips/mitum/util/logging"
 	"github.com/spikeekips/mitum/util/ps"
 )
@@ -26,6 +28,7 @@ type DebugFlags struct {
 	DebugHTTP string `name:"debug-http" help:"runtime debug thru https" group:"dev" placeholder:"bind address" default:":9090"`
 	Statsviz  bool   `name:"statsviz" help:"enable statsviz thru https" group:"dev"`
 	Pprof     bool   `name:"pprof" help:"enable runtime pprof thru https" group:"dev"`
+	ClockSkew string `name:"clock-skew" help:"shift local time by the offset in file" group:"dev" placeholder:"file"`
 }
 
 type RunCommand struct { //nolint:govet //...
@@ -59,6 +62,7 @@ func (cmd *RunCommand) Run(pctx context.Context) error {
 		Interface("debug_http", cmd.DebugHTTP).
 		Interface("statsviz", cmd.Statsviz).
 		Interface("pprof", cmd.Pprof).
+		Interface("clock_skew", cmd.ClockSkew).
 		Interface("dev", cmd.DevFlags).
 		Interface("acl", cmd.ACLFlags).
 		Msg("flags")
@@ -77,6 +81,12 @@ func (cmd *RunCommand) Run(pctx context.Context) error {
 		}
 	}
 
+	if len(cmd.ClockSkew) > 0 {
+		if err := cmd.enableClockSkew(pctx, log); err != nil {
+			return errors.Wrap(err, "enable clock skew")
+		}
+	}
+
 	if cmd.mux != nil {
 		addr, err := net.ResolveTCPAddr("tcp", cmd.DebugHTTP)
 		if err != nil {
@@ -142,6 +152,8 @@ func (cmd *RunCommand) Run(pctx context.Context) error {
 
 var errHoldStop = util.NewIDError("hold stop")
 
+var clockSkewCheckInterval = time.Second
+
 func (cmd *RunCommand) run(pctx context.Context) error {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -293,3 +305,36 @@ func (cmd *RunCommand) enablePprof() error {
 
 	return nil
 }
+
+// enableClockSkew shifts the localtime.Now() of node; the TimeSyncer follows
+// the local time server, which answers the local time shifted by the offset
+// in the --dev.clock-skew file.
+func (cmd *RunCommand) enableClockSkew(ctx context.Context, log *logging.Logging) error {
+	ts, err := NewTimeServer("127.0.0.1:0", cmd.ClockSkew)
+	if err != nil {
+		return err
+	}
+
+	_ = ts.SetLogging(log)
+
+	if err := ts.Start(ctx); err != nil {
+		return err
+	}
+
+	syncer, err := localtime.NewTimeSyncer(ts.Host(), ts.Port(), clockSkewCheckInterval)
+	if err != nil {
+		return err
+	}
+
+	_ = syncer.SetLogging(log)
+
+	if err := syncer.Start(ctx); err != nil {
+		return err
+	}
+
+	localtime.SetDefaultTimeSyncer(syncer)
+
+	cmd.log.Debug().Str("file", cmd.ClockSkew).Msg("clock skew enabled")
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spikeekips/mitum/util"
+	"github.com/spikeekips/mitum/util/logging"
+)
+
+const ntpPacketSize = 48
+
+var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// TimeServer is the simple SNTP server, which answers the local time shifted
+// by the offset in the offset file. The offset file is read at every request,
+// so the offset can be changed while running; the offset file has the
+// duration string like "-3s" and the missing or empty file means no offset.
+type TimeServer struct {
+	*logging.Logging
+	*util.ContextDaemon
+	conn       *net.UDPConn
+	offsetFile string
+}
+
+func NewTimeServer(bind, offsetFile string) (*TimeServer, error) {
+	addr, err := net.ResolveUDPAddr("udp", bind)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	s := &TimeServer{
+		Logging: logging.NewLogging(func(zctx zerolog.Context) zerolog.Context {
+			return zctx.Str("module", "time-server")
+		}),
+		conn:       conn,
+		offsetFile: offsetFile,
+	}
+
+	s.ContextDaemon = util.NewContextDaemon(s.start)
+
+	return s, nil
+}
+
+func (s *TimeServer) Host() string {
+	return s.conn.LocalAddr().(*net.UDPAddr).IP.String() //nolint:forcetypeassert //...
+}
+
+func (s *TimeServer) Port() int {
+	return s.conn.LocalAddr().(*net.UDPAddr).Port //nolint:forcetypeassert //...
+}
+
+func (s *TimeServer) Offset() (time.Duration, error) {
+	switch b, err := os.ReadFile(s.offsetFile); {
+	case os.IsNotExist(err):
+		return 0, nil
+	case err != nil:
+		return 0, errors.WithStack(err)
+	default:
+		i := strings.TrimSpace(string(b))
+		if len(i) < 1 {
+			return 0, nil
+		}
+
+		d, err := time.ParseDuration(i)
+		if err != nil {
+			return 0, errors.WithMessage(err, "offset")
+		}
+
+		return d, nil
+	}
+}
+
+func (s *TimeServer) start(ctx context.Context) error {
+	donech := make(chan struct{})
+	defer close(donech)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-donech:
+		}
+
+		_ = s.conn.Close()
+	}()
+
+	b := make([]byte, 512) //nolint:mnd //...
+
+	for {
+		n, raddr, err := s.conn.ReadFromUDP(b)
+
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return errors.WithStack(err)
+		case n < ntpPacketSize:
+			continue
+		}
+
+		if err := s.reply(b[:ntpPacketSize], raddr); err != nil {
+			s.Log().Error().Err(err).Stringer("remote", raddr).Msg("failed to reply")
+		}
+	}
+}
+
+func (s *TimeServer) reply(req []byte, raddr *net.UDPAddr) error {
+	offset, err := s.Offset()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn.WriteToUDP(ntpResponse(req, time.Now().Add(offset)), raddr)
+
+	return errors.WithStack(err)
+}
+
+func ntpResponse(req []byte, now time.Time) []byte {
+	b := make([]byte, ntpPacketSize)
+
+	b[0] = req[0]&0x38 | 4 // NOTE leap none, version of request and server mode
+	b[1] = 1               // NOTE stratum; primary
+	b[2] = req[2]
+	b[3] = 0xec // NOTE precision; 2^-20 second
+
+	copy(b[12:16], "LOCL")
+
+	t := ntpTime(now)
+
+	binary.BigEndian.PutUint64(b[16:24], t) // NOTE reference time
+	copy(b[24:32], req[40:48])              // NOTE origin time is the transmit time of request
+	binary.BigEndian.PutUint64(b[32:40], t) // NOTE receive time
+	binary.BigEndian.PutUint64(b[40:48], t) // NOTE transmit time
+
+	return b
+}
+
+func ntpTime(t time.Time) uint64 {
+	d := t.Sub(ntpEpoch)
+	sec := uint64(d / time.Second)
+	frac := uint64(d%time.Second) << 32 / uint64(time.Second) //nolint:mnd //...
+
+	return sec<<32 | frac //nolint:mnd //...
+}
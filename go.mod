@@ -9,6 +9,7 @@ require (
 	github.com/alecthomas/kong v1.2.1
 	github.com/docker/docker v27.3.1+incompatible
 	github.com/docker/go-connections v0.5.0
+	github.com/oklog/ulid/v2 v2.1.0
 	github.com/oleksandr/conditions v0.0.0-20170913191404-8ed8af13bdec
 	github.com/pkg/errors v0.9.1
 	github.com/pkg/sftp v1.13.6
@@ -104,7 +105,6 @@ require (
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/ncruces/go-strftime v0.1.9 // indirect
 	github.com/nxadm/tail v1.4.8 // indirect
-	github.com/oklog/ulid/v2 v2.1.0 // indirect
 	github.com/onsi/ginkgo/v2 v2.20.2 // indirect
 	github.com/opencontainers/go-digest v1.0.0 // indirect
 	github.com/opencontainers/image-spec v1.1.0 // indirect
@@ -44,6 +44,9 @@ type Host interface { //nolint:interfacebloat //...
 	Client() *dockerClient.Client
 	Mkdir(string, os.FileMode) error
 	Upload(_ io.Reader, name, dest string, _ os.FileMode) error
+	// Link links the file, which already exists in host, into the base
+	// directory; if link fails, the file is copied.
+	Link(source, name, dest string) error
 	CollectResult(outputfile string) error
 	ExistsContainer(_ context.Context, containerName string) (string, string, bool, error)
 	CreateContainer(
@@ -61,9 +64,18 @@ type Host interface { //nolint:interfacebloat //...
 		whenExit func(container.WaitResponse, error),
 	) error
 	StopContainer(_ context.Context, containerName string, _ *time.Duration) error
+	// PauseContainer freezes the processes of container; unlike stop, the
+	// sockets are kept open.
+	PauseContainer(_ context.Context, containerName string) error
+	UnpauseContainer(_ context.Context, containerName string) error
+	// KillContainer sends the signal to container without graceful stop;
+	// empty signal is SIGKILL.
+	KillContainer(_ context.Context, containerName, signal string) error
 	RemoveContainer(_ context.Context, containerName string, _ container.RemoveOptions) error
 	ContainerLogs(_ context.Context, containerName string, _ container.LogsOptions) (io.ReadCloser, error)
 	FreePort(id, network string) (string, error)
+	// Port returns the port, which is already assigned to id by FreePort.
+	Port(id string) (string, bool)
 	RunCommand(string) (string, string, bool, error)
 }
 
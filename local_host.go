@@ -3,6 +3,7 @@ package contest
 import (
 	"archive/tar"
 	"bytes"
+	"fmt"
 	"io"
 	"io/fs"
 	"net/url"
@@ -95,6 +96,24 @@ func (h *LocalHost) Upload(s io.Reader, name, dest string, mode os.FileMode) err
 	return nil
 }
 
+func (h *LocalHost) Link(source, name, dest string) error {
+	e := util.StringError("link")
+
+	newdest := filepath.Join(h.base, dest)
+
+	_ = os.Remove(newdest)
+
+	if err := os.Link(source, newdest); err != nil {
+		if _, _, err := h.runCommand(fmt.Sprintf(`cp -p '%s' '%s'`, source, newdest)); err != nil {
+			return e.Wrap(err)
+		}
+	}
+
+	h.addFile(name, newdest)
+
+	return nil
+}
+
 func (h *LocalHost) CollectResult(outputfile string) error {
 	e := util.StringError("collect result")
 
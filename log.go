@@ -3,7 +3,9 @@ package contest
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/oleksandr/conditions"
@@ -15,28 +17,48 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+var ErrConditionViolated = util.NewIDError("condition violated")
+
+// PeekQueryContextKey is set to the context of the condition queries, which
+// should not move the clock of logs, like invariants; replay keeps the clock
+// by them.
+var PeekQueryContextKey = util.ContextKey("peek-query")
+
 type WatchLogs struct {
 	*logging.Logging
 	*util.ContextDaemon
 	actionFunc           func(context.Context, ScenarioAction) error
 	insertLogEntriesFunc func(context.Context, []LogEntry) error
 	vars                 *Vars
+	pushMatchers         *pushMatchers
+	inserted             *insertedMark
 	getHostFunc          func(string) Host
+	clock                func() time.Time
 	findDBFunc           func(context.Context, bson.M) (interface{}, bool, error)
 	countDBFunc          func(context.Context, bson.M) (int64, error)
+	aggregateDBFunc      func(context.Context, bson.A) ([]map[string]interface{}, error)
+	waiting              map[string]string
 	expects              []ExpectScenario
-	actives              []ExpectScenario
+	invariants           []Invariant
+	results              []ExpectResult
 	checkInterval        time.Duration
+	slowQuery            time.Duration
+	previousMatch        string
+	waitingLock          sync.Mutex
+	resultsLock          sync.Mutex
+	previousMatchLock    sync.Mutex
 }
 
 func NewWatchLogs(
 	expects []ExpectScenario,
+	invariants []Invariant,
 	savelogch chan LogEntry,
 	checkInterval *time.Duration,
 	vars *Vars,
 	getHostFunc func(string) Host,
 	findDBFunc func(context.Context, bson.M) (interface{}, bool, error),
 	countDBFunc func(context.Context, bson.M) (int64, error),
+	aggregateDBFunc func(context.Context, bson.A) ([]map[string]interface{}, error),
 	actionFunc func(context.Context, ScenarioAction) error,
 	insertLogEntriesFunc func(context.Context, []LogEntry) error,
 ) *WatchLogs {
@@ -45,24 +67,41 @@ func NewWatchLogs(
 		ucheckInterval = *checkInterval
 	}
 
-	actives := make([]ExpectScenario, len(expects))
-	copy(actives, expects)
-
 	w := &WatchLogs{
 		Logging: logging.NewLogging(func(zctx zerolog.Context) zerolog.Context {
 			return zctx.Str("module", "watch-logs")
 		}),
 		expects:              expects,
-		actives:              actives,
+		invariants:           invariants,
+		waiting:              map[string]string{},
 		checkInterval:        ucheckInterval,
+		slowQuery:            time.Second,
+		pushMatchers:         newPushMatchers(),
+		inserted:             &insertedMark{pending: map[int64]struct{}{}},
 		vars:                 vars,
 		getHostFunc:          getHostFunc,
-		findDBFunc:           findDBFunc,
-		countDBFunc:          countDBFunc,
 		actionFunc:           actionFunc,
 		insertLogEntriesFunc: insertLogEntriesFunc,
 	}
 
+	w.findDBFunc = func(ctx context.Context, m bson.M) (interface{}, bool, error) {
+		defer w.checkSlowQuery(time.Now(), "find", m)
+
+		return findDBFunc(ctx, m)
+	}
+
+	w.countDBFunc = func(ctx context.Context, m bson.M) (int64, error) {
+		defer w.checkSlowQuery(time.Now(), "count", m)
+
+		return countDBFunc(ctx, m)
+	}
+
+	w.aggregateDBFunc = func(ctx context.Context, pipeline bson.A) ([]map[string]interface{}, error) {
+		defer w.checkSlowQuery(time.Now(), "aggregate", pipeline)
+
+		return aggregateDBFunc(ctx, pipeline)
+	}
+
 	w.ContextDaemon = util.NewContextDaemon(func(ctx context.Context) error {
 		return w.start(ctx, savelogch)
 	})
@@ -70,84 +109,794 @@ func NewWatchLogs(
 	return w
 }
 
+// expectSequence keeps the state of expects, which are evaluated one by one.
+// The top level expects and each track of parallel expect have their own
+// sequence.
+type expectSequence struct {
+	l        zerolog.Logger
+	ended    <-chan struct{}
+	loop     map[string]interface{}
+	name     string
+	interval time.Duration
+}
+
+func (seq *expectSequence) track(name string) *expectSequence {
+	return &expectSequence{
+		l:        seq.l.With().Str("track", name).Logger(),
+		name:     name,
+		interval: seq.interval,
+		loop:     seq.loop,
+	}
+}
+
+// background returns the sequence for the never expect; ended is closed when
+// the enclosing expects are finished.
+func (seq *expectSequence) background(ended <-chan struct{}) *expectSequence {
+	return &expectSequence{
+		l:        seq.l,
+		name:     seq.name,
+		interval: seq.interval,
+		loop:     seq.loop,
+		ended:    ended,
+	}
+}
+
+// vars returns the vars for the expects of sequence. In repeat, `.loop` of the
+// iteration is set to the copy of vars, so it is not shared by the other
+// sequences.
+func (seq *expectSequence) vars(vars *Vars) *Vars {
+	if seq.loop == nil {
+		return vars
+	}
+
+	return vars.Clone(map[string]interface{}{".loop": seq.loop})
+}
+
+func (seq *expectSequence) path(index int) string {
+	if len(seq.name) < 1 {
+		return fmt.Sprintf("%d", index)
+	}
+
+	return fmt.Sprintf("%s/%d", seq.name, index)
+}
+
 func (w *WatchLogs) start(ctx context.Context, savelogch chan LogEntry) error {
 	go w.saveLogs(ctx, savelogch)
 
-	active, queries, err := w.newactive()
-	if err != nil {
+	ictx, icancel := context.WithCancel(ctx)
+	defer icancel()
+
+	for i := range w.invariants {
+		if err := w.watchInvariant(ictx, i, w.invariants[i]); err != nil {
+			return err
+		}
+	}
+
+	seq := &expectSequence{l: *w.Log(), interval: w.checkInterval}
+
+	if err := w.runExpects(ctx, w.expects, seq); err != nil {
 		return err
 	}
 
-	if len(queries) > 0 {
-		w.Log().Debug().Stringer("query", queries[0]).Msg("querying")
+	w.Log().Info().Msg("finished")
+
+	return nil
+}
+
+// WaitingExpects returns the expects, which are waiting for their condition,
+// with the last query.
+func (w *WatchLogs) WaitingExpects() []string {
+	w.waitingLock.Lock()
+	defer w.waitingLock.Unlock()
+
+	s := make([]string, 0, len(w.waiting))
+
+	for path := range w.waiting {
+		s = append(s, fmt.Sprintf("expect #%s: %s", path, w.waiting[path]))
 	}
 
-	if active.Log != "" {
+	sort.Strings(s)
+
+	return s
+}
+
+// SetSlowQuery sets the duration; the condition queries slower than it are
+// logged. Zero disables it.
+func (w *WatchLogs) SetSlowQuery(d time.Duration) *WatchLogs {
+	w.slowQuery = d
+
+	return w
+}
+
+// SetClock sets the clock of timeout, initial wait, absent window and the times
+// of results; replay moves the clock over the stored logs. Nil is the wall
+// clock.
+func (w *WatchLogs) SetClock(now func() time.Time) *WatchLogs {
+	w.clock = now
+
+	return w
+}
+
+func (w *WatchLogs) now() time.Time {
+	if w.clock == nil {
+		return time.Now()
+	}
+
+	return w.clock()
+}
+
+// after returns the channel, which receives after the duration by the clock;
+// with SetClock, the clock is checked in every check interval. The returned
+// function stops it.
+func (w *WatchLogs) after(d time.Duration) (<-chan time.Time, func()) {
+	if w.clock == nil {
+		timer := time.NewTimer(d)
+
+		return timer.C, func() {
+			_ = timer.Stop()
+		}
+	}
+
+	ch := make(chan time.Time, 1)
+	done := make(chan struct{})
+	deadline := w.clock().Add(d)
+
+	go func() {
+		ticker := time.NewTicker(w.checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if now := w.clock(); !now.Before(deadline) {
+					ch <- now
+
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, func() {
+		close(done)
+	}
+}
+
+func (w *WatchLogs) wait(ctx context.Context, d time.Duration) error {
+	ch, stop := w.after(d)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ch:
+		return nil
+	}
+}
+
+// checkSlowQuery logs the query, which took longer than the slow query duration.
+func (w *WatchLogs) checkSlowQuery(started time.Time, kind string, query interface{}) {
+	if w.slowQuery < 1 {
+		return
+	}
+
+	if elapsed := time.Since(started); elapsed > w.slowQuery {
+		w.Log().Warn().
+			Str("kind", kind).
+			Interface("query", query).
+			Dur("elapsed", elapsed).
+			Msg("slow condition query; consider adding indexes")
+	}
+}
+
+// Results returns the results of expects in the evaluated order.
+func (w *WatchLogs) Results() []ExpectResult {
+	w.resultsLock.Lock()
+	defer w.resultsLock.Unlock()
+
+	r := make([]ExpectResult, len(w.results))
+	copy(r, w.results)
+
+	return r
+}
+
+func (w *WatchLogs) newResult(path string, expect ExpectScenario) *ExpectResult {
+	w.resultsLock.Lock()
+	defer w.resultsLock.Unlock()
+
+	r := ExpectResult{
+		Path:      path,
+		Label:     expect.Label,
+		Condition: expect.ConditionString(),
+		Started:   w.now(),
+		Status:    ExpectResultPending,
+		nowFunc:   w.now,
+		index:     len(w.results),
+	}
+
+	w.results = append(w.results, r)
+
+	return &r
+}
+
+func (w *WatchLogs) setResult(r *ExpectResult) {
+	w.resultsLock.Lock()
+	defer w.resultsLock.Unlock()
+
+	n := *r
+
+	if r.Registered != nil {
+		n.Registered = make(map[string]interface{}, len(r.Registered))
+
+		for k := range r.Registered {
+			n.Registered[k] = r.Registered[k]
+		}
+	}
+
+	w.results[r.index] = n
+}
+
+func (w *WatchLogs) setWaiting(path string, query ConditionQuery) {
+	w.waitingLock.Lock()
+	defer w.waitingLock.Unlock()
+
+	switch {
+	case query == nil:
+		delete(w.waiting, path)
+	default:
+		w.waiting[path] = query.String()
+	}
+}
+
+// runExpects evaluates the expects in order. The never expect watches in
+// background until the expects are finished; if it is violated without
+// on_fail, the expects are stopped with the violation.
+func (w *WatchLogs) runExpects(ctx context.Context, expects []ExpectScenario, seq *expectSequence) error {
+	sctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	ended := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	err := w.runExpectsFlow(sctx, expects, seq, func(expect ExpectScenario, path string) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// NOTE the never expect does not move the clock of replay.
+			bctx := context.WithValue(sctx, PeekQueryContextKey, true)
+
+			if _, err := w.runExpect(bctx, expect, path, seq.background(ended)); err != nil && sctx.Err() == nil {
+				cancel(err)
+			}
+		}()
+	})
+
+	close(ended)
+	wg.Wait()
+
+	if ctx.Err() == nil && sctx.Err() != nil {
+		return context.Cause(sctx)
+	}
+
+	return err
+}
+
+func (w *WatchLogs) runExpectsFlow(
+	ctx context.Context,
+	expects []ExpectScenario,
+	seq *expectSequence,
+	background func(ExpectScenario, string),
+) error {
+	labels := map[string]int{}
+
+	for i := range expects {
+		if len(expects[i].Label) > 0 {
+			labels[expects[i].Label] = i
+		}
+	}
+
+	for i := 0; i < len(expects); {
+		if expects[i].isNever() {
+			seq.l.Debug().Str("expect", seq.path(i)).Msg("never expect watches in background")
+
+			background(expects[i], seq.path(i))
+			i++
+
+			continue
+		}
+
+		label, err := w.runExpect(ctx, expects[i], seq.path(i), seq)
+		if err != nil {
+			return err
+		}
+
+		if len(label) < 1 {
+			i++
+
+			continue
+		}
+
+		j, found := labels[label]
+		if !found {
+			return errors.Errorf("expect #%s; goto label not found, %q", seq.path(i), label)
+		}
+
+		seq.l.Debug().Str("expect", seq.path(i)).Str("label", label).Str("to", seq.path(j)).Msg("goto")
+
+		i = j
+	}
+
+	return nil
+}
+
+// runExpect evaluates the expect until it's condition is matched. It returns
+// the label of next expect if the flow is changed by goto.
+func (w *WatchLogs) runExpect(
+	ctx context.Context, expect ExpectScenario, path string, seq *expectSequence,
+) (string, error) {
+	if !expect.IsBlock() && expect.Log != "" {
+		active, err := expect.Compile(seq.vars(w.vars))
+		if err != nil {
+			return "", err
+		}
+
 		w.expectLog(active.Log)
+
+		return "", nil
 	}
 
-	interval := w.checkInterval
-	initialWait := active.InitialWait
+	result := w.newResult(path, expect)
 
-end:
-	for {
-		var updated bool
+	w.insertExpectEvent(ctx, "expect started", result, bson.M{"condition": result.Condition})
+
+	label, err := w.evaluateExpect(ctx, expect, path, seq, result)
+
+	switch {
+	case result.Status != ExpectResultPending:
+		if err != nil && len(result.Error) < 1 {
+			result.Error = err.Error()
+		}
+	case err == nil:
+		result.finish(ExpectResultMatched, nil)
+	case ctx.Err() != nil:
+		result.finish(ExpectResultCanceled, nil)
+	default:
+		result.finish(ExpectResultError, err)
+	}
+
+	w.setResult(result)
+
+	w.insertExpectEvent(ctx, "expect "+string(result.Status), result, expectResultEventX(*result))
+
+	return label, err
+}
+
+func (w *WatchLogs) evaluateExpect(
+	ctx context.Context, expect ExpectScenario, path string, seq *expectSequence, result *ExpectResult,
+) (string, error) {
+	if expect.IsBlock() {
+		if expect.Log != "" {
+			w.expectLog(expect.Log)
+		}
+
+		switch err := w.runBlock(ctx, expect, path, seq); {
+		case err == nil:
+			result.finish(ExpectResultMatched, nil)
+
+			return w.expectFlow(ctx, expect.OnMatch, path, seq, result, "on_match")
+		case expect.Timeout > 0 && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded):
+			return w.expectTimeout(ctx, expect, path, nil, seq, result)
+		default:
+			return "", err
+		}
+	}
+
+	active, queries, err := w.compileExpect(expect, seq)
+	if err != nil {
+		return "", err
+	}
+
+	result.Queries = make([]string, len(queries))
 
-		if initialWait > 0 {
-			w.Log().Debug().Dur("initial_wait", initialWait).Msg("initial wait")
+	for i := range queries {
+		result.Queries[i] = queries[i].String()
+	}
+
+	w.setResult(result)
+
+	if active.Interval > 1 {
+		seq.interval = active.Interval
+	}
+
+	if len(queries) > 0 {
+		seq.l.Debug().Dur("interval", seq.interval).Stringer("query", queries[0]).Msg("querying")
+	}
 
-			<-time.After(initialWait)
+	if active.InitialWait > 0 {
+		seq.l.Debug().Dur("initial_wait", active.InitialWait).Msg("initial wait")
+
+		if err := w.wait(ctx, active.InitialWait); err != nil {
+			return "", err
 		}
+	}
+
+	var timeoutch <-chan time.Time
+
+	if active.Timeout > 0 {
+		ch, stop := w.after(active.Timeout)
+		defer stop()
+
+		timeoutch = ch
+	}
+
+	defer w.setWaiting(path, nil)
+
+	defer w.pushMatchers.subscribe(queries...)()
+
+	for {
+		w.setWaiting(path, queries[0])
+
+		switch left, ok, err := w.evaluate(ctx, active, queries, result, seq.vars(w.vars)); {
+		case errors.Is(err, ErrConditionViolated):
+			seq.l.Debug().Err(err).Str("expect", path).Msg("condition violated")
+
+			result.finish(ExpectResultFailed, err)
+
+			if active.OnFail == nil {
+				return "", err
+			}
 
-		switch left, ok, err := w.evaluate(ctx, active, queries); {
+			return w.expectFlow(ctx, active.OnFail, path, seq, result, "on_fail")
 		case err != nil:
-			return err
+			return "", err
 		case !ok:
-		case len(w.actives) < 1: // NOTE finished
-			break end
-		case len(left) < 1:
-			active, queries, err = w.newactive()
-			if err != nil {
-				return err
-			}
+			if active.OnFail != nil && active.Timeout < 1 && !active.isAbsent() {
+				seq.l.Debug().Str("expect", path).Msg("condition failed")
 
-			if active.Log != "" {
-				w.expectLog(active.Log)
-			}
+				result.finish(ExpectResultFailed, nil)
 
-			if active.Interval > 1 {
-				interval = active.Interval
+				return w.expectFlow(ctx, active.OnFail, path, seq, result, "on_fail")
 			}
+		case len(left) < 1:
+			result.finish(ExpectResultMatched, nil)
 
-			initialWait = active.InitialWait
-			updated = true
+			return w.expectFlow(ctx, active.OnMatch, path, seq, result, "on_match")
 		default:
 			queries = left
-			updated = true
-		}
 
-		if updated && len(queries) > 0 {
-			w.Log().Debug().Dur("interval", interval).Stringer("query", queries[0]).Msg("querying")
+			seq.l.Debug().Dur("interval", seq.interval).Stringer("query", queries[0]).Msg("querying")
 		}
 
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(interval):
+			return "", ctx.Err()
+		case <-timeoutch:
+			if !expireAbsent(queries) {
+				return w.expectTimeout(ctx, active, path, queries[0], seq, result)
+			}
+
+			timeoutch = nil
+		case <-seq.ended:
+			_ = expireAbsent(queries)
+		case <-waitPushed(queries[0]):
+		case <-time.After(seq.interval):
 		}
 	}
+}
 
-	w.Log().Info().Msg("finished")
+// expireAbsent ends the window of the absent queries; the next evaluation is
+// matched unless violated. It returns false if the queries are not absent.
+func expireAbsent(queries []ConditionQuery) bool {
+	var found bool
+
+	for i := range queries {
+		if c, ok := queries[i].(*AbsentConditionQuery); ok {
+			c.expired = true
+			found = true
+		}
+	}
+
+	return found
+}
+
+func (w *WatchLogs) expectTimeout(
+	ctx context.Context,
+	expect ExpectScenario,
+	path string,
+	query ConditionQuery,
+	seq *expectSequence,
+	result *ExpectResult,
+) (string, error) {
+	result.finish(ExpectResultTimedOut, nil)
+
+	var q string
+	if query != nil {
+		q = query.String()
+	}
+
+	seq.l.Debug().
+		Str("expect", path).
+		Dur("timeout", expect.Timeout).
+		Str("condition", expect.ConditionString()).
+		Str("query", q).
+		Int("on_timeout", len(expect.OnTimeout)).
+		Msg("expect timed out")
+
+	if len(expect.OnTimeout) < 1 && expect.OnFail == nil {
+		if expect.IsBlock() {
+			return "", errors.Errorf("expect #%s timed out after %s; parallel or repeat", path, expect.Timeout)
+		}
+
+		return "", errors.Errorf("expect #%s timed out after %s; condition=%q, last query=%s",
+			path, expect.Timeout, expect.ConditionString(), q)
+	}
+
+	for i := range expect.OnTimeout {
+		action := expect.OnTimeout[i]
+
+		if err := w.runAction(ctx, action, result, "on_timeout"); err != nil {
+			seq.l.Error().Err(err).Interface("action", action).Msg("failed to run on_timeout action")
+
+			return "", err
+		}
+	}
+
+	return w.expectFlow(ctx, expect.OnFail, path, seq, result, "on_fail")
+}
+
+func (w *WatchLogs) expectFlow(
+	ctx context.Context,
+	flow *ExpectFlow,
+	path string,
+	seq *expectSequence,
+	result *ExpectResult,
+	trigger string,
+) (string, error) {
+	if flow == nil {
+		return "", nil
+	}
+
+	for i := range flow.Actions {
+		action := flow.Actions[i]
+
+		if err := w.runAction(ctx, action, result, trigger); err != nil {
+			seq.l.Error().Err(err).Str("expect", path).Interface("action", action).Msg("failed to run flow action")
+
+			return "", err
+		}
+	}
+
+	return flow.Goto, nil
+}
+
+func (w *WatchLogs) runBlock(ctx context.Context, expect ExpectScenario, path string, seq *expectSequence) error {
+	bctx := ctx
+
+	if expect.Timeout > 0 {
+		i, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		timeoutch, stop := w.after(expect.Timeout)
+		defer stop()
+
+		go func() {
+			select {
+			case <-i.Done():
+			case <-timeoutch:
+				cancel(context.DeadlineExceeded)
+			}
+		}()
+
+		bctx = i
+	}
+
+	var err error
+
+	switch {
+	case expect.Parallel != nil:
+		err = w.runParallel(bctx, *expect.Parallel, path, seq)
+	case expect.Repeat != nil:
+		err = w.runRepeat(bctx, *expect.Repeat, path, seq)
+	default:
+		return errors.Errorf("not block expect")
+	}
+
+	if err != nil && ctx.Err() == nil && errors.Is(context.Cause(bctx), context.DeadlineExceeded) {
+		return errors.WithStack(context.DeadlineExceeded)
+	}
+
+	return err
+}
+
+func (w *WatchLogs) runRepeat(ctx context.Context, repeat ExpectRepeat, path string, seq *expectSequence) error {
+	for i := 0; repeat.Count < 1 || i < repeat.Count; i++ {
+		rseq := seq.track(fmt.Sprintf("%s/loop%d", path, i))
+		rseq.loop = map[string]interface{}{"index": i, "count": repeat.Count}
+
+		rseq.l.Debug().Int("index", i).Int("count", repeat.Count).Msg("repeat")
+
+		if err := w.runExpects(ctx, repeat.Expects, rseq); err != nil {
+			return errors.WithMessagef(err, "repeat %d", i)
+		}
+
+		if repeat.Until == nil {
+			continue
+		}
+
+		switch matched, err := w.findAll(ctx, ExpectScenario{Condition: repeat.Until}, rseq.vars(w.vars)); {
+		case err != nil:
+			return errors.WithMessage(err, "until")
+		case matched:
+			rseq.l.Debug().Int("index", i).Msg("repeat until matched")
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// findAll checks the condition of expect once; it returns true when all the
+// queries are matched.
+func (w *WatchLogs) findAll(ctx context.Context, expect ExpectScenario, vars *Vars) (bool, error) {
+	active, err := expect.Compile(vars)
+	if err != nil {
+		return false, err
+	}
+
+	queries, err := w.compileConditionQueries(active, vars)
+	if err != nil {
+		return false, err
+	}
+
+	for i := range queries {
+		switch _, found, err := queries[i].Find(ctx); {
+		case err != nil:
+			return false, err
+		case !found:
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (w *WatchLogs) runParallel(
+	ctx context.Context, parallel ExpectParallel, path string, seq *expectSequence,
+) error {
+	pctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type trackResult struct {
+		err  error
+		name string
+	}
+
+	resultch := make(chan trackResult, len(parallel.Tracks))
+
+	for i := range parallel.Tracks {
+		track := parallel.Tracks[i]
+		tseq := seq.track(path + "/" + track.TrackName(i))
+
+		tseq.l.Debug().Int("expects", len(track.Expects)).Msg("track started")
+
+		go func() {
+			resultch <- trackResult{name: tseq.name, err: w.runExpects(pctx, track.Expects, tseq)}
+		}()
+	}
+
+	var done int
+
+	defer func() {
+		cancel()
+
+		for ; done < len(parallel.Tracks); done++ { // NOTE wait the canceled tracks
+			<-resultch
+		}
+	}()
+
+	for done < len(parallel.Tracks) {
+		r := <-resultch
+		done++
+
+		switch {
+		case r.err == nil:
+			seq.l.Debug().Str("track", r.name).Msg("track finished")
+
+			if parallel.Join == ExpectJoinAny {
+				return nil
+			}
+		default:
+			return errors.WithMessagef(r.err, "track %q", r.name)
+		}
+	}
+
+	return nil
+}
+
+func (w *WatchLogs) watchInvariant(ctx context.Context, index int, invariant Invariant) error {
+	l := w.Log().With().Int("invariant", index).Str("name", invariant.Name).Logger()
+
+	expect, err := invariant.expect().Compile(w.vars)
+	if err != nil {
+		return errors.WithMessagef(err, "invariant #%d", index)
+	}
+
+	queries, err := w.compileConditionQueries(expect, w.vars)
+	if err != nil {
+		return errors.WithMessagef(err, "invariant #%d", index)
+	}
+
+	interval := w.checkInterval
+	if invariant.Interval > 0 {
+		interval = invariant.Interval
+	}
+
+	l.Debug().Dur("interval", interval).Interface("queries", queries).Msg("watching invariant")
+
+	// NOTE the invariants do not move the clock of replay.
+	ctx = context.WithValue(ctx, PeekQueryContextKey, true)
+
+	unsubscribe := w.pushMatchers.subscribe(queries...)
+	pushedch := mergePushed(ctx, queries)
+
+	go func() {
+		defer unsubscribe()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-pushedch:
+			case <-ticker.C:
+			}
+
+			for i := range queries {
+				switch out, found, err := queries[i].Find(ctx); {
+				case err != nil:
+					if ctx.Err() == nil {
+						l.Error().Err(err).Stringer("query", queries[i]).Msg("failed to check invariant")
+					}
+				case found:
+					b, _ := util.MarshalJSON(out)
+
+					msg := fmt.Sprintf("invariant #%d(%s) violated; query=%s, matched=%s",
+						index, invariant.Name, queries[i], string(b))
+
+					l.Error().Stringer("query", queries[i]).RawJSON("matched", b).Msg("invariant violated")
+
+					if err := w.actionFunc(ctx, ScenarioAction{
+						Type: string(IfConditionFailedStopContest),
+						Args: []string{msg},
+					}); err != nil {
+						l.Error().Err(err).Msg("failed to stop contest")
+					}
+
+					return
+				}
+			}
+		}
+	}()
 
 	return nil
 }
 
-func (w *WatchLogs) newactive() (newactive ExpectScenario, queries []ConditionQuery, _ error) {
-	selected, left := w.actives[0], w.actives[1:]
+func (w *WatchLogs) compileExpect(
+	selected ExpectScenario, seq *expectSequence,
+) (active ExpectScenario, queries []ConditionQuery, _ error) {
+	vars := seq.vars(w.vars)
 
-	active, err := selected.Compile(w.vars)
+	active, err := selected.Compile(vars)
 	if err != nil {
-		w.Log().Error().
+		seq.l.Error().
 			Err(err).
 			Interface("selected", selected).
 			Msg("failed to compile expect")
@@ -156,14 +905,12 @@ func (w *WatchLogs) newactive() (newactive ExpectScenario, queries []ConditionQu
 	}
 
 	if active.Log != "" {
-		w.actives = left
-
 		return active, nil, nil
 	}
 
-	qs, err := w.compileConditionQueries(active)
+	qs, err := w.compileConditionQueries(active, vars)
 	if err != nil {
-		w.Log().Error().
+		seq.l.Error().
 			Err(err).
 			Interface("selected", selected).
 			Msg("failed to compile query")
@@ -171,7 +918,7 @@ func (w *WatchLogs) newactive() (newactive ExpectScenario, queries []ConditionQu
 		return active, nil, err
 	}
 
-	w.Log().Debug().
+	seq.l.Debug().
 		Interface("expect", active).
 		Func(func(e *zerolog.Event) {
 			s := make([]fmt.Stringer, len(qs))
@@ -184,14 +931,14 @@ func (w *WatchLogs) newactive() (newactive ExpectScenario, queries []ConditionQu
 		}).
 		Msg("new expect")
 
-	w.actives = left
-
 	return active, qs, nil
 }
 
-func (w *WatchLogs) compileConditionQueries(expect ExpectScenario) (queries []ConditionQuery, _ error) {
+func (w *WatchLogs) compileConditionQueries(
+	expect ExpectScenario, vars *Vars,
+) (queries []ConditionQuery, _ error) {
 	if len(expect.Range) < 1 {
-		query, err := w.compileConditionQuery(expect.Condition, w.vars, nil)
+		query, err := w.compileConditionQuery(expect.Condition, vars, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -204,7 +951,7 @@ func (w *WatchLogs) compileConditionQueries(expect ExpectScenario) (queries []Co
 	queries = make([]ConditionQuery, len(rv))
 
 	for i := range rv {
-		query, err := w.compileConditionQuery(expect.Condition, w.vars.Clone(nil), rv[i])
+		query, err := w.compileConditionQuery(expect.Condition, vars.Clone(nil), rv[i])
 		if err != nil {
 			return nil, err
 		}
@@ -251,21 +998,12 @@ func (w *WatchLogs) compileStringConditionQuery(
 
 	switch n := strings.TrimLeft(s, " "); {
 	case strings.HasPrefix(n, "{"):
-		c, err := CompileTemplate(n, vars, nil)
+		m, err := w.compileMongodbQuery(n, vars, rangeValue)
 		if err != nil {
 			return nil, e.Wrap(err)
 		}
 
-		var m bson.M
-		if err := bson.UnmarshalExtJSON([]byte(c), false, &m); err != nil {
-			return nil, errors.WithMessagef(err, "unmarshal query, %q", c)
-		}
-
-		for k := range rangeValue {
-			m[k] = rangeValue[k]
-		}
-
-		return MongodbFindConditionQuery{findDBFunc: w.findDBFunc, m: m}, nil
+		return w.newFindConditionQuery(m, false), nil
 	case strings.HasPrefix(n, "$ "):
 		if len(alias) < 1 {
 			return nil, e.Errorf("empty alias for hostCommandConditionQuery, %q", s)
@@ -276,64 +1014,267 @@ func (w *WatchLogs) compileStringConditionQuery(
 			return nil, e.Errorf("host not found")
 		}
 
-		vars.Set(".self.host", host)
+		vars.Set(".self.host", host)
+
+		c, err := CompileTemplate(n[1:], vars, nil)
+		if err != nil {
+			return nil, e.Wrap(err)
+		}
+
+		return HostCommandConditionQuery{host: host, cmd: c}, nil
+	default:
+		return nil, e.Errorf("unknown condition, %q", s)
+	}
+}
+
+func (w *WatchLogs) compileMapConditionQuery(
+	s map[string]interface{}, vars *Vars, rangeValue map[string]interface{},
+) (ConditionQuery, error) {
+	e := util.StringError("compile condition map query")
+
+	var query, countString, absent, until, aggregate, since string
+	var count conditions.Expr
+	var window time.Duration
+	var isabsent, isnever, incremental bool
+
+	for key := range s {
+		var value string
+
+		switch t := s[key].(type) {
+		case string:
+			value = t
+		default:
+			return nil, e.Errorf("unknown map condition value type, %T", t)
+		}
+
+		switch key {
+		case "query":
+			query = value
+		case "count":
+			p := conditions.NewParser(strings.NewReader(fmt.Sprintf("$0 %s", value)))
+
+			expr, err := p.Parse()
+			if err != nil {
+				return nil, e.Wrap(err)
+			}
+
+			count = expr
+			countString = value
+		case "absent":
+			absent = value
+			isabsent = true
+		case "never":
+			absent = value
+			isnever = true
+		case "for":
+			d, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil {
+				return nil, e.Wrap(err)
+			}
+
+			window = d
+		case "until":
+			until = value
+		case "aggregate":
+			aggregate = value
+		case "since":
+			i, err := w.compileSince(value, vars)
+			if err != nil {
+				return nil, e.Wrap(err)
+			}
+
+			since = i
+			incremental = true
+		default:
+			return nil, e.Errorf("unknown map condition key, %q", key)
+		}
+	}
+
+	vars.Set(".self.range", rangeValue)
+
+	switch {
+	case len(aggregate) > 0 && (len(query) > 0 || isabsent || isnever):
+		return nil, e.Errorf("aggregate can not be used with query, absent or never")
+	case len(aggregate) > 0:
+		return w.compileAggregateConditionQuery(aggregate, count, countString, since, vars, rangeValue)
+	case isabsent && isnever:
+		return nil, e.Errorf("absent and never can not be used together")
+	case (isabsent || isnever) && incremental:
+		return nil, e.Errorf("since can not be used with absent or never")
+	case isabsent || isnever:
+		return w.compileAbsentConditionQuery(absent, isnever, window, until, vars, rangeValue)
+	case count == nil && !incremental:
+		return w.compileStringConditionQuery(query, vars, rangeValue)
+	}
+
+	m, err := w.compileMongodbQuery(query, vars, rangeValue)
+	if err != nil {
+		return nil, e.Wrap(err)
+	}
+
+	m = queryAfterID(m, "$gt", since)
+
+	if count == nil {
+		return w.newFindConditionQuery(m, incremental), nil
+	}
+
+	if !incremental {
+		return MongodbCountConditionQuery{
+			countDBFunc: w.countDBFunc,
+			m:           m,
+			count:       count,
+			countString: countString,
+		}, nil
+	}
+
+	return &IncrementalCountConditionQuery{
+		countDBFunc: w.countDBFunc,
+		markFunc:    w.inserted.mark,
+		m:           m,
+		count:       count,
+		countString: countString,
+	}, nil
+}
+
+// compileSince returns the _id, which the condition checks the entries after;
+// `previous_match` is the entry matched by the latest matched expect. The
+// condition with since is evaluated incrementally; the next query checks only
+// the entries inserted after the previous query.
+func (w *WatchLogs) compileSince(s string, vars *Vars) (string, error) {
+	c, err := CompileTemplate(s, vars, nil)
+	if err != nil {
+		return "", err
+	}
+
+	switch c = strings.TrimSpace(c); {
+	case c == "previous_match":
+		w.previousMatchLock.Lock()
+		defer w.previousMatchLock.Unlock()
+
+		return w.previousMatch, nil
+	case IsULID(c):
+		return c, nil
+	default:
+		return "", errors.Errorf("since should be previous_match or ulid, %q", c)
+	}
+}
+
+func (w *WatchLogs) setPreviousMatch(record interface{}) {
+	m, ok := record.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	id, ok := m["_id"].(string)
+	if !ok || !IsULID(id) {
+		return
+	}
+
+	w.previousMatchLock.Lock()
+	defer w.previousMatchLock.Unlock()
+
+	w.previousMatch = id
+}
+
+func (w *WatchLogs) newFindConditionQuery(m bson.M, incremental bool) ConditionQuery {
+	c := &PushFindConditionQuery{
+		findDBFunc:   w.findDBFunc,
+		pushedRecord: newPushedRecord(),
+		m:            m,
+	}
+
+	if incremental {
+		c.markFunc = w.inserted.mark
+	}
+
+	return c
+}
+
+func (w *WatchLogs) compileAbsentConditionQuery(
+	query string,
+	never bool,
+	window time.Duration,
+	until string,
+	vars *Vars,
+	rangeValue map[string]interface{},
+) (ConditionQuery, error) {
+	e := util.StringError("compile absent condition query")
+
+	switch {
+	case never && (window > 0 || len(until) > 0):
+		return nil, e.Errorf("never can not have for or until")
+	case !never && window < 1 && len(until) < 1:
+		return nil, e.Errorf("absent needs for or until")
+	}
+
+	m, err := w.compileMongodbQuery(query, vars, rangeValue)
+	if err != nil {
+		return nil, e.Wrap(err)
+	}
+
+	c := &AbsentConditionQuery{
+		findDBFunc:  w.findDBFunc,
+		countDBFunc: w.countDBFunc,
+		nowFunc:     w.now,
+		seqFunc:     w.inserted.next,
+		m:           m,
+		window:      window,
+	}
 
-		c, err := CompileTemplate(n[1:], vars, nil)
+	if len(until) > 0 {
+		um, err := w.compileMongodbQuery(until, vars, rangeValue)
 		if err != nil {
 			return nil, e.Wrap(err)
 		}
 
-		return HostCommandConditionQuery{host: host, cmd: c}, nil
-	default:
-		return nil, e.Errorf("unknown condition, %q", s)
+		c.until = MongodbFindConditionQuery{findDBFunc: w.findDBFunc, m: um}
 	}
+
+	return c, nil
 }
 
-func (w *WatchLogs) compileMapConditionQuery(
-	s map[string]interface{}, vars *Vars, rangeValue map[string]interface{},
+func (w *WatchLogs) compileAggregateConditionQuery(
+	s string,
+	count conditions.Expr,
+	countString string,
+	since string,
+	vars *Vars,
+	rangeValue map[string]interface{},
 ) (ConditionQuery, error) {
-	e := util.StringError("compile condition map query")
-
-	var query, countString string
-	var count conditions.Expr
-
-	for key := range s {
-		var value string
-
-		switch t := s[key].(type) {
-		case string:
-			value = t
-		default:
-			return nil, e.Errorf("unknown map condition value type, %T", t)
-		}
-
-		switch key {
-		case "query":
-			query = value
-		case "count":
-			p := conditions.NewParser(strings.NewReader(fmt.Sprintf("$0 %s", value)))
+	e := util.StringError("compile aggregate condition query")
 
-			expr, err := p.Parse()
-			if err != nil {
-				return nil, e.Wrap(err)
-			}
+	c, err := CompileTemplate(s, vars, nil)
+	if err != nil {
+		return nil, e.Wrap(err)
+	}
 
-			count = expr
-			countString = value
-		default:
-			return nil, e.Errorf("unknown map condition key, %q", key)
-		}
+	var pipeline bson.A
+	if err := bson.UnmarshalExtJSON([]byte(c), false, &pipeline); err != nil {
+		return nil, e.WithMessage(err, "unmarshal pipeline, %q", c)
 	}
 
-	vars.Set(".self.range", rangeValue)
+	if len(rangeValue) > 0 {
+		pipeline = append(bson.A{bson.M{"$match": rangeValue}}, pipeline...)
+	}
 
-	if count == nil {
-		return w.compileStringConditionQuery(query, vars, rangeValue)
+	if len(since) > 0 {
+		pipeline = append(bson.A{bson.M{"$match": bson.M{"_id": bson.M{"$gt": since}}}}, pipeline...)
 	}
 
-	c, err := CompileTemplate(query, vars, nil)
+	return MongodbAggregateConditionQuery{
+		aggregateDBFunc: w.aggregateDBFunc,
+		pipeline:        pipeline,
+		count:           count,
+		countString:     countString,
+	}, nil
+}
+
+func (*WatchLogs) compileMongodbQuery(
+	s string, vars *Vars, rangeValue map[string]interface{},
+) (bson.M, error) {
+	c, err := CompileTemplate(s, vars, nil)
 	if err != nil {
-		return nil, e.Wrap(err)
+		return nil, err
 	}
 
 	var m bson.M
@@ -345,22 +1286,17 @@ func (w *WatchLogs) compileMapConditionQuery(
 		m[k] = rangeValue[k]
 	}
 
-	return MongodbCountConditionQuery{
-		countDBFunc: w.countDBFunc,
-		m:           m,
-		count:       count,
-		countString: countString,
-	}, nil
+	return m, nil
 }
 
 func (w *WatchLogs) evaluate(
-	ctx context.Context, expect ExpectScenario, queries []ConditionQuery,
+	ctx context.Context, expect ExpectScenario, queries []ConditionQuery, result *ExpectResult, vars *Vars,
 ) (left []ConditionQuery, ok bool, _ error) {
 	if expect.Log != "" {
 		return nil, true, nil
 	}
 
-	current, err := expect.Compile(w.vars)
+	current, err := expect.Compile(vars)
 	if err != nil {
 		return left, false, err
 	}
@@ -391,6 +1327,10 @@ func (w *WatchLogs) evaluate(
 		l.Debug().Interface("out", i).Msg("matched")
 
 		r = i
+
+		result.Records = append(result.Records, i)
+
+		w.setPreviousMatch(i)
 	}
 
 	for i := range current.Registers {
@@ -404,6 +1344,16 @@ func (w *WatchLogs) evaluate(
 			return left, ok, err
 		}
 
+		if v, found := w.vars.Value(register.Assign); found {
+			if result.Registered == nil {
+				result.Registered = map[string]interface{}{}
+			}
+
+			result.Registered[register.Assign] = v
+
+			w.insertExpectEvent(ctx, "expect registered", result, bson.M{"assign": register.Assign, "value": v})
+		}
+
 		l.Debug().Msg("registered")
 	}
 
@@ -412,7 +1362,7 @@ func (w *WatchLogs) evaluate(
 
 		l := w.Log().With().Interface("action", action).Logger()
 
-		if err := w.actionFunc(ctx, action); err != nil {
+		if err := w.runAction(ctx, action, result, "match"); err != nil {
 			l.Error().Err(err).Msg("failed to run action")
 
 			return left, ok, err
@@ -424,6 +1374,80 @@ func (w *WatchLogs) evaluate(
 	return left, true, nil
 }
 
+// runAction runs the action of expect and records it to the result.
+func (w *WatchLogs) runAction(
+	ctx context.Context, action ScenarioAction, result *ExpectResult, trigger string,
+) error {
+	x := bson.M{"trigger": trigger, "type": action.Type, "args": action.Args}
+
+	w.insertExpectEvent(ctx, "expect action started", result, x)
+
+	err := w.actionFunc(ctx, action)
+	result.addAction(trigger, action, err)
+
+	if err != nil {
+		x["error"] = err.Error()
+	}
+
+	w.insertExpectEvent(ctx, "expect action finished", result, x)
+
+	return err
+}
+
+// insertExpectEvent inserts the lifecycle event of expect into log database
+// as InternalLogEntry, so the later expects can query the progress of contest
+// with the same conditions.
+func (w *WatchLogs) insertExpectEvent(ctx context.Context, msg string, result *ExpectResult, x bson.M) {
+	m := bson.M{"expect": result.Path}
+
+	if len(result.Label) > 0 {
+		m["label"] = result.Label
+	}
+
+	for k := range x {
+		m[k] = x[k]
+	}
+
+	// NOTE the events of canceled expect are also inserted.
+	ictx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second*3) //nolint:mnd //...
+	defer cancel()
+
+	entries := []LogEntry{NewInternalLogEntryWithX(msg, nil, m)}
+
+	seq := w.inserted.pend(entries)
+	err := w.insertLogEntriesFunc(ictx, entries)
+
+	w.inserted.done(seq)
+
+	if err != nil {
+		w.Log().Error().Err(err).Str("msg", msg).Interface("x", m).Msg("failed to insert expect event")
+	}
+}
+
+func expectResultEventX(r ExpectResult) bson.M {
+	x := bson.M{"status": string(r.Status), "duration": r.Duration().String()}
+
+	if len(r.Error) > 0 {
+		x["error"] = r.Error
+	}
+
+	var ids []interface{}
+
+	for i := range r.Records {
+		if m, ok := r.Records[i].(map[string]interface{}); ok {
+			if id, found := m["_id"]; found {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	if len(ids) > 0 {
+		x["matched"] = ids
+	}
+
+	return x
+}
+
 func (w *WatchLogs) register(record interface{}, register ScenarioRegister) error {
 	var v interface{}
 
@@ -454,10 +1478,14 @@ func (w *WatchLogs) saveLogs(ctx context.Context, ch chan LogEntry) {
 			return
 		}
 
+		seq := w.inserted.pend(entries)
+
 		if err := w.insertLogEntriesFunc(ctx, entries); err != nil {
 			log.Error().Err(err).Msg("failed to save logs")
 		}
 
+		w.inserted.done(seq)
+
 		entries = nil
 	}
 
@@ -474,6 +1502,10 @@ end:
 				break end
 			}
 
+			if err := w.pushMatchers.match(e); err != nil {
+				w.Log().Error().Err(err).Msg("failed to push log entry")
+			}
+
 			entries = append(entries, e)
 
 			if len(entries) > 33 { //nolint:mnd //...
@@ -487,6 +1519,76 @@ end:
 	save()
 }
 
+// insertedMark assigns the insert sequence, `seq`, to the log entries before
+// they are inserted. The node log entries are created by the log writers of
+// nodes concurrently, so the order of _id is not the order of insertion; the
+// seq is. The entries below the mark are already inserted; the pending
+// entries hold the mark below them until they are inserted.
+type insertedMark struct {
+	pending map[int64]struct{}
+	seq     int64
+	sync.Mutex
+}
+
+// mark returns the seq; the entries below it are already inserted. Zero mark
+// means nothing is inserted yet.
+func (m *insertedMark) mark() int64 {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.seq < 1 {
+		return 0
+	}
+
+	mark := m.seq + 1
+
+	for seq := range m.pending {
+		if seq < mark {
+			mark = seq
+		}
+	}
+
+	return mark
+}
+
+// next returns the seq of the entries, which will be inserted.
+func (m *insertedMark) next() int64 {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.seq < 1 {
+		return 0
+	}
+
+	return m.seq + 1
+}
+
+// pend assigns the seq to entries and holds the mark below them until done.
+// It returns the first seq of entries.
+func (m *insertedMark) pend(entries []LogEntry) int64 {
+	m.Lock()
+	defer m.Unlock()
+
+	first := m.seq + 1
+
+	for i := range entries {
+		m.seq++
+
+		entries[i] = entries[i].WithSeq(m.seq)
+	}
+
+	m.pending[first] = struct{}{}
+
+	return first
+}
+
+func (m *insertedMark) done(seq int64) {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.pending, seq)
+}
+
 func (w *WatchLogs) ifConditionFailed(ctx context.Context, scenario ExpectScenario, err string) error {
 	switch scenario.IfConditionFailed {
 	case IfConditionFailedNothing:
@@ -548,6 +1650,266 @@ func (c MongodbCountConditionQuery) Find(ctx context.Context) (out interface{},
 	return nil, r, errors.WithStack(err)
 }
 
+// MongodbAggregateConditionQuery runs the aggregation pipeline; it is matched
+// when the pipeline returns documents, or the number of documents satisfies
+// count. The documents are the result.
+type MongodbAggregateConditionQuery struct {
+	count           conditions.Expr
+	aggregateDBFunc func(context.Context, bson.A) ([]map[string]interface{}, error)
+	pipeline        bson.A
+	countString     string
+}
+
+func (c MongodbAggregateConditionQuery) String() string {
+	m := map[string]interface{}{"aggregate": c.pipeline}
+
+	if c.count != nil {
+		m["count"] = c.countString
+	}
+
+	b, _ := util.MarshalJSON(m)
+
+	return string(b)
+}
+
+func (c MongodbAggregateConditionQuery) Find(ctx context.Context) (out interface{}, ok bool, _ error) {
+	docs, err := c.aggregateDBFunc(ctx, c.pipeline)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if c.count == nil {
+		return docs, len(docs) > 0, nil
+	}
+
+	r, err := conditions.Evaluate(c.count, map[string]interface{}{"$0": int64(len(docs))})
+
+	return docs, r, errors.WithStack(err)
+}
+
+// PushFindConditionQuery finds the entry in the database; the entry pushed by
+// saving logs is matched without the database. With markFunc, it is
+// incremental; when not matched, the mark moves to the inserted mark before
+// the query, so the next query checks only the new entries.
+type PushFindConditionQuery struct {
+	findDBFunc   func(context.Context, bson.M) (interface{}, bool, error)
+	markFunc     func() int64
+	pushedRecord *pushedRecord
+	m            bson.M
+	mark         int64
+}
+
+func (c *PushFindConditionQuery) String() string {
+	b, _ := util.MarshalJSON(c.m)
+
+	return string(b)
+}
+
+func (c *PushFindConditionQuery) Find(ctx context.Context) (out interface{}, ok bool, _ error) {
+	if r, found := c.pushedRecord.take(); found {
+		return r, true, nil
+	}
+
+	if c.markFunc == nil {
+		return c.findDBFunc(ctx, c.m)
+	}
+
+	mark := c.markFunc()
+
+	switch i, found, err := c.findDBFunc(ctx, queryAfterSeq(c.m, "$gte", c.mark)); {
+	case err != nil, found:
+		return i, found, err
+	default:
+		if mark > c.mark {
+			c.mark = mark
+		}
+
+		return i, false, nil
+	}
+}
+
+// IncrementalCountConditionQuery counts the entries before the inserted mark
+// once and adds them to the count of the entries after the mark.
+type IncrementalCountConditionQuery struct {
+	count       conditions.Expr
+	countDBFunc func(context.Context, bson.M) (int64, error)
+	markFunc    func() int64
+	m           bson.M
+	countString string
+	mark        int64
+	base        int64
+}
+
+func (c *IncrementalCountConditionQuery) String() string {
+	b, _ := util.MarshalJSON(map[string]interface{}{
+		"query": c.m,
+		"count": c.countString,
+	})
+
+	return string(b)
+}
+
+func (c *IncrementalCountConditionQuery) Find(ctx context.Context) (out interface{}, ok bool, _ error) {
+	if mark := c.markFunc(); mark > c.mark {
+		// NOTE the entries without seq are also counted before the mark.
+		i, err := c.countDBFunc(ctx, bson.M{"$and": bson.A{
+			queryAfterSeq(c.m, "$gte", c.mark),
+			bson.M{"seq": bson.M{"$not": bson.M{"$gte": mark}}},
+		}})
+		if err != nil {
+			return nil, false, err
+		}
+
+		c.base += i
+		c.mark = mark
+	}
+
+	i, err := c.countDBFunc(ctx, queryAfterSeq(c.m, "$gte", c.mark))
+	if err != nil {
+		return nil, false, err
+	}
+
+	r, err := conditions.Evaluate(c.count, map[string]interface{}{"$0": c.base + i})
+
+	return nil, r, errors.WithStack(err)
+}
+
+// queryAfterID adds the range of _id to the query; empty id is ignored.
+func queryAfterID(m bson.M, op, id string) bson.M {
+	if len(id) < 1 {
+		return m
+	}
+
+	return bson.M{"$and": bson.A{m, bson.M{"_id": bson.M{op: id}}}}
+}
+
+// queryAfterSeq adds the range of insert sequence to the query; zero seq is
+// ignored.
+func queryAfterSeq(m bson.M, op string, seq int64) bson.M {
+	if seq < 1 {
+		return m
+	}
+
+	return bson.M{"$and": bson.A{m, bson.M{"seq": bson.M{op: seq}}}}
+}
+
+// AbsentConditionQuery is matched when the query stays unmatched for the
+// window, until the until query is matched or until it is expired. The entries
+// before the first evaluation are not checked. If the query is matched, it
+// returns ErrConditionViolated.
+type AbsentConditionQuery struct {
+	started     time.Time
+	until       ConditionQuery
+	findDBFunc  func(context.Context, bson.M) (interface{}, bool, error)
+	countDBFunc func(context.Context, bson.M) (int64, error)
+	nowFunc     func() time.Time
+	seqFunc     func() int64
+	m           bson.M
+	since       string
+	sinceSeq    int64
+	window      time.Duration
+	seeded      bool
+	expired     bool
+}
+
+func (c *AbsentConditionQuery) String() string {
+	m := map[string]interface{}{"absent": c.m}
+
+	if c.window > 0 {
+		m["for"] = c.window.String()
+	}
+
+	if c.until != nil {
+		m["until"] = c.until.String()
+	}
+
+	b, _ := util.MarshalJSON(m)
+
+	return string(b)
+}
+
+func (c *AbsentConditionQuery) Find(ctx context.Context) (out interface{}, ok bool, _ error) {
+	if !c.seeded {
+		if err := c.seed(ctx); err != nil {
+			return nil, false, err
+		}
+	}
+
+	m := queryAfterSeq(queryAfterID(c.m, "$gt", c.since), "$gte", c.sinceSeq)
+
+	if err := c.violated(ctx, m); err != nil {
+		return nil, false, err
+	}
+
+	if c.expired || (c.window > 0 && c.nowFunc().Sub(c.started) >= c.window) {
+		return nil, true, nil
+	}
+
+	if c.until == nil {
+		return nil, false, nil
+	}
+
+	switch i, found, err := c.until.Find(ctx); {
+	case err != nil, !found:
+		return i, found, err
+	default:
+		// NOTE check again the entries before until; in replay, the clock may
+		// jump to until.
+		if r, ok := i.(map[string]interface{}); ok {
+			if id, ok := r["_id"].(string); ok {
+				m = queryAfterID(m, "$lt", id)
+			}
+		}
+
+		if err := c.violated(ctx, m); err != nil {
+			return nil, false, err
+		}
+
+		return i, true, nil
+	}
+}
+
+// seed sets the seq of the next inserted entry; the entries inserted after it
+// are checked. In replay, nothing is inserted, so the entries after the latest
+// stored entry before the clock are checked.
+func (c *AbsentConditionQuery) seed(ctx context.Context) error {
+	if c.sinceSeq = c.seqFunc(); c.sinceSeq < 1 {
+		i, _, err := c.findDBFunc(context.WithValue(ctx, PeekQueryContextKey, true), bson.M{})
+		if err != nil {
+			return err
+		}
+
+		if m, ok := i.(map[string]interface{}); ok {
+			c.since, _ = m["_id"].(string)
+		}
+	}
+
+	c.started = c.nowFunc()
+	c.seeded = true
+
+	return nil
+}
+
+// violated counts the entries of query; in replay, the count moves the clock,
+// so the window can pass.
+func (c *AbsentConditionQuery) violated(ctx context.Context, m bson.M) error {
+	switch n, err := c.countDBFunc(ctx, m); {
+	case err != nil:
+		return err
+	case n < 1:
+		return nil
+	}
+
+	i, _, err := c.findDBFunc(context.WithValue(ctx, PeekQueryContextKey, true), m)
+	if err != nil {
+		return err
+	}
+
+	b, _ := util.MarshalJSON(i)
+
+	return ErrConditionViolated.Errorf("absent condition matched, %s; found=%s", c, string(b))
+}
+
 type HostCommandConditionQuery struct {
 	host Host
 	cmd  string
@@ -15,26 +15,53 @@ import (
 type LogEntry interface {
 	bson.Marshaler
 	X()
+	ID() string
+	// WithSeq sets the insert sequence, which is assigned when the entry is
+	// inserted.
+	WithSeq(int64) LogEntry
 }
 
 type InternalLogEntry struct {
 	id  string
 	t   time.Time
 	err error
+	x   bson.M
 	msg string
+	seq int64
 }
 
 func NewInternalLogEntry(msg string, err error) InternalLogEntry {
 	return InternalLogEntry{id: util.ULID().String(), t: localtime.Now().UTC(), msg: msg, err: err}
 }
 
+// NewInternalLogEntryWithX creates new InternalLogEntry with the extra fields,
+// which are stored under `x` like NodeLogEntry.
+func NewInternalLogEntryWithX(msg string, err error, x bson.M) InternalLogEntry {
+	e := NewInternalLogEntry(msg, err)
+	e.x = x
+
+	return e
+}
+
 func (InternalLogEntry) X() {}
 
+func (e InternalLogEntry) ID() string {
+	return e.id
+}
+
+func (e InternalLogEntry) WithSeq(seq int64) LogEntry {
+	e.seq = seq
+
+	return e
+}
+
 type InternalLogEntryBSONMarshaler struct {
 	T   time.Time `bson:"t"`
-	Err error     `bson:"error"` //nolint:tagliatelle //...
-	ID  string    `bson:"_id"`   //nolint:tagliatelle //...
+	Err error     `bson:"error"`       //nolint:tagliatelle //...
+	X   bson.M    `bson:"x,omitempty"` //nolint:tagliatelle //...
+	ID  string    `bson:"_id"`         //nolint:tagliatelle //...
 	Msg string    `bson:"msg"`
+	Seq int64     `bson:"seq,omitempty"`
 }
 
 func (e InternalLogEntry) MarshalBSON() ([]byte, error) {
@@ -43,6 +70,8 @@ func (e InternalLogEntry) MarshalBSON() ([]byte, error) {
 		T:   e.t,
 		Msg: e.msg,
 		Err: e.err,
+		X:   e.x,
+		Seq: e.seq,
 	})
 
 	return b, errors.WithStack(err)
@@ -54,6 +83,7 @@ type NodeLogEntry struct {
 	node   string
 	x      bson.Raw
 	stderr bool
+	seq    int64
 }
 
 func NewNodeLogEntryWithInterface(node string, stderr bool, i interface{}) (entry NodeLogEntry, _ error) {
@@ -108,12 +138,23 @@ func NewNodeLogEntry(node string, stderr bool, b []byte) (entry NodeLogEntry, _
 
 func (NodeLogEntry) X() {}
 
+func (e NodeLogEntry) ID() string {
+	return e.id
+}
+
+func (e NodeLogEntry) WithSeq(seq int64) LogEntry {
+	e.seq = seq
+
+	return e
+}
+
 type NodeLogEntryBSONMarshaler struct {
 	ID     string    `bson:"_id"` //nolint:tagliatelle //...
 	T      time.Time `bson:"t"`
 	Node   string    `bson:"node"`
 	X      bson.Raw  `bson:"x"`
 	Stderr bool      `bson:"stderr"`
+	Seq    int64     `bson:"seq,omitempty"`
 }
 
 func (e NodeLogEntry) MarshalBSON() ([]byte, error) {
@@ -123,6 +164,7 @@ func (e NodeLogEntry) MarshalBSON() ([]byte, error) {
 		Node:   e.node,
 		X:      e.x,
 		Stderr: e.stderr,
+		Seq:    e.seq,
 	})
 
 	return b, errors.WithStack(err)
@@ -0,0 +1,208 @@
+package contest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// pushQuery is the condition query, which can be matched with the log entries
+// as they arrive, before they are saved to the database.
+type pushQuery interface {
+	ConditionQuery
+	pushFilter() bson.M
+	push(map[string]interface{})
+	pushed() <-chan struct{}
+}
+
+type pushMatcher struct {
+	q     pushQuery
+	query map[string]interface{}
+}
+
+type pushMatchers struct {
+	m map[pushQuery]pushMatcher
+	sync.RWMutex
+}
+
+func newPushMatchers() *pushMatchers {
+	return &pushMatchers{m: map[pushQuery]pushMatcher{}}
+}
+
+// subscribe registers the queries; the returned function unregisters them.
+func (p *pushMatchers) subscribe(queries ...ConditionQuery) func() {
+	p.Lock()
+	defer p.Unlock()
+
+	var subscribed []pushQuery
+
+	for i := range queries {
+		q, ok := queries[i].(pushQuery)
+		if !ok {
+			continue
+		}
+
+		query, ok := normalizeBSONValue(q.pushFilter()).(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		p.m[q] = pushMatcher{q: q, query: query}
+
+		subscribed = append(subscribed, q)
+	}
+
+	return func() {
+		p.Lock()
+		defer p.Unlock()
+
+		for i := range subscribed {
+			delete(p.m, subscribed[i])
+		}
+	}
+}
+
+// match pushes the entry to the matched queries. The query, which can not be
+// evaluated in memory, is unregistered and left to the database.
+func (p *pushMatchers) match(entry LogEntry) error {
+	p.RLock()
+	n := len(p.m)
+	p.RUnlock()
+
+	if n < 1 {
+		return nil
+	}
+
+	b, err := entry.MarshalBSON()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var record map[string]interface{}
+	if err := bson.Unmarshal(b, &record); err != nil {
+		return errors.WithStack(err)
+	}
+
+	doc, _ := normalizeBSONValue(record).(map[string]interface{})
+
+	var failed []pushQuery
+
+	p.RLock()
+
+	for q := range p.m {
+		switch matched, err := matchBSONDocument(doc, p.m[q].query); {
+		case err != nil:
+			failed = append(failed, q)
+		case matched:
+			q.push(record)
+		}
+	}
+
+	p.RUnlock()
+
+	if len(failed) > 0 {
+		p.Lock()
+
+		for i := range failed {
+			delete(p.m, failed[i])
+		}
+
+		p.Unlock()
+	}
+
+	return nil
+}
+
+// pushedRecord keeps the latest pushed record until it is taken by Find.
+type pushedRecord struct {
+	record map[string]interface{}
+	ch     chan struct{}
+	sync.Mutex
+}
+
+func newPushedRecord() *pushedRecord {
+	return &pushedRecord{ch: make(chan struct{}, 1)}
+}
+
+func (p *pushedRecord) push(record map[string]interface{}) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.record = record
+
+	select {
+	case p.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pushedRecord) take() (map[string]interface{}, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.record == nil {
+		return nil, false
+	}
+
+	r := p.record
+	p.record = nil
+
+	return r, true
+}
+
+func (p *pushedRecord) pushed() <-chan struct{} {
+	return p.ch
+}
+
+// waitPushed returns the channel, which is notified when the entry matched with
+// the query arrives; if the query is not pushQuery, it returns nil.
+func waitPushed(q ConditionQuery) <-chan struct{} {
+	if p, ok := q.(pushQuery); ok {
+		return p.pushed()
+	}
+
+	return nil
+}
+
+// mergePushed returns the channel, which is notified when any of the queries
+// is pushed.
+func mergePushed(ctx context.Context, queries []ConditionQuery) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	for i := range queries {
+		p := waitPushed(queries[i])
+		if p == nil {
+			continue
+		}
+
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-p:
+					select {
+					case ch <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	return ch
+}
+
+func (c *PushFindConditionQuery) pushFilter() bson.M {
+	return c.m
+}
+
+func (c *PushFindConditionQuery) push(record map[string]interface{}) {
+	c.pushedRecord.push(record)
+}
+
+func (c *PushFindConditionQuery) pushed() <-chan struct{} {
+	return c.pushedRecord.pushed()
+}
@@ -0,0 +1,103 @@
+package contest
+
+import (
+	"time"
+
+	"github.com/spikeekips/mitum/util"
+)
+
+type ExpectResultStatus string
+
+const (
+	ExpectResultPending  ExpectResultStatus = "pending"
+	ExpectResultMatched  ExpectResultStatus = "matched"
+	ExpectResultFailed   ExpectResultStatus = "failed"
+	ExpectResultTimedOut ExpectResultStatus = "timed_out"
+	ExpectResultError    ExpectResultStatus = "error"
+	ExpectResultCanceled ExpectResultStatus = "canceled"
+)
+
+// ExpectResult is the result of expect; for each evaluation of expect, new
+// result is added.
+type ExpectResult struct {
+	Started    time.Time              `json:"started"`
+	Finished   time.Time              `json:"finished,omitempty"`
+	Registered map[string]interface{} `json:"registered,omitempty"`
+	Path       string                 `json:"path"`
+	Label      string                 `json:"label,omitempty"`
+	Condition  string                 `json:"condition,omitempty"`
+	Status     ExpectResultStatus     `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	Queries    []string               `json:"queries,omitempty"`
+	Records    []interface{}          `json:"records,omitempty"`
+	Actions    []ExpectActionResult   `json:"actions,omitempty"`
+	nowFunc    func() time.Time
+	index      int
+}
+
+type ExpectActionResult struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Trigger string    `json:"trigger"`
+	Error   string    `json:"error,omitempty"`
+	Args    []string  `json:"args,omitempty"`
+}
+
+func (r ExpectResult) Duration() time.Duration {
+	if r.Finished.IsZero() {
+		return 0
+	}
+
+	return r.Finished.Sub(r.Started)
+}
+
+func (r ExpectResult) MarshalJSON() ([]byte, error) {
+	type alias ExpectResult
+
+	var finished *time.Time
+	var duration string
+
+	if !r.Finished.IsZero() {
+		finished = &r.Finished
+		duration = r.Duration().String()
+	}
+
+	return util.MarshalJSON(struct { //nolint:wrapcheck //...
+		Finished *time.Time `json:"finished,omitempty"`
+		alias
+		Duration string `json:"duration,omitempty"`
+	}{
+		alias:    alias(r),
+		Finished: finished,
+		Duration: duration,
+	})
+}
+
+func (r *ExpectResult) addAction(trigger string, action ScenarioAction, err error) {
+	a := ExpectActionResult{Time: r.now(), Type: action.Type, Args: action.Args, Trigger: trigger}
+
+	if err != nil {
+		a.Error = err.Error()
+	}
+
+	r.Actions = append(r.Actions, a)
+}
+
+func (r *ExpectResult) finish(status ExpectResultStatus, err error) {
+	r.Finished = r.now()
+	r.Status = status
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// now returns the time of the clock of WatchLogs; in replay, it is the log
+// time.
+func (r *ExpectResult) now() time.Time {
+	if r.nowFunc == nil {
+		return time.Now()
+	}
+
+	return r.nowFunc()
+}
@@ -0,0 +1,753 @@
+package contest
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/mitum/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LogStore stores the log entries and evaluates the conditions of expects
+// against them.
+type LogStore interface {
+	InsertLogEntries(context.Context, []LogEntry) error
+	Find(context.Context, bson.M) (map[string]interface{}, bool, error)
+	Count(context.Context, bson.M) (int64, error)
+	Aggregate(context.Context, bson.A) ([]map[string]interface{}, error)
+	Traverse(context.Context, bson.M, *options.FindOptions, func(map[string]interface{}) (bool, error)) error
+	CreateIndexes(context.Context, []mongo.IndexModel) error
+	Close(context.Context) error
+}
+
+var (
+	_ LogStore = (*Mongodb)(nil)
+	_ LogStore = (*MemoryLogStore)(nil)
+)
+
+// MemoryLogStore keeps the log entries in memory. It supports the subset of
+// mongodb query; field conditions with $eq, $ne, $gt, $gte, $lt, $lte, $in,
+// $nin, $exists, $regex and $not, and $and, $or and $nor.
+type MemoryLogStore struct {
+	records []memoryLogRecord
+	sync.RWMutex
+}
+
+type memoryLogRecord struct {
+	m   map[string]interface{}
+	id  string
+	raw bson.Raw
+}
+
+func NewMemoryLogStore() *MemoryLogStore {
+	return &MemoryLogStore{}
+}
+
+func (db *MemoryLogStore) InsertLogEntries(_ context.Context, entries []LogEntry) error {
+	records := make([]memoryLogRecord, len(entries))
+
+	for i := range entries {
+		b, err := entries[i].MarshalBSON()
+		if err != nil {
+			return err
+		}
+
+		var m map[string]interface{}
+
+		if err := bson.Unmarshal(b, &m); err != nil {
+			return errors.WithStack(err)
+		}
+
+		id, _ := m["_id"].(string)
+
+		records[i] = memoryLogRecord{id: id, raw: b, m: normalizeBSONValue(m).(map[string]interface{})} //nolint:forcetypeassert,lll //...
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	for i := range records {
+		// NOTE keep sorted by _id
+		j := sort.Search(len(db.records), func(j int) bool {
+			return db.records[j].id > records[i].id
+		})
+
+		db.records = append(db.records, memoryLogRecord{})
+		copy(db.records[j+1:], db.records[j:])
+		db.records[j] = records[i]
+	}
+
+	return nil
+}
+
+func (db *MemoryLogStore) Find(ctx context.Context, query bson.M) (record map[string]interface{}, found bool, _ error) {
+	err := db.Traverse(ctx, query, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(1),
+		func(m map[string]interface{}) (bool, error) {
+			record = m
+			found = true
+
+			return false, nil
+		},
+	)
+
+	return record, found, err
+}
+
+func (db *MemoryLogStore) Count(ctx context.Context, query bson.M) (count int64, _ error) {
+	err := db.Traverse(ctx, query, nil, func(map[string]interface{}) (bool, error) {
+		count++
+
+		return true, nil
+	})
+
+	return count, err
+}
+
+// Traverse iterates the matched entries; the sort, limit, skip and inclusive
+// projection of opts are supported.
+func (db *MemoryLogStore) Traverse(
+	ctx context.Context,
+	query bson.M,
+	opts *options.FindOptions,
+	f func(map[string]interface{}) (bool, error),
+) error {
+	if opts == nil {
+		opts = options.Find()
+	}
+
+	matched, err := db.matchSorted(query, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Skip != nil {
+		skip := int(*opts.Skip)
+		if skip > len(matched) {
+			skip = len(matched)
+		}
+
+		matched = matched[skip:]
+	}
+
+	if opts.Limit != nil && *opts.Limit > 0 && int(*opts.Limit) < len(matched) {
+		matched = matched[:*opts.Limit]
+	}
+
+	for i := range matched {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		var m map[string]interface{}
+
+		if err := bson.Unmarshal(matched[i].raw, &m); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if opts.Projection != nil {
+			p, err := projectBSONDocument(m, opts.Projection)
+			if err != nil {
+				return err
+			}
+
+			m = p
+		}
+
+		switch keep, err := f(m); {
+		case err != nil:
+			return err
+		case !keep:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// CreateIndexes does nothing; the entries are not indexed.
+func (*MemoryLogStore) CreateIndexes(context.Context, []mongo.IndexModel) error {
+	return nil
+}
+
+func (*MemoryLogStore) Close(context.Context) error {
+	return nil
+}
+
+// matchSorted returns the sorted matched records. The records are kept sorted
+// by _id, so the first one by _id, like the latest entry of Find, is found by
+// scanning the records in order and stops at the first match.
+func (db *MemoryLogStore) matchSorted(query bson.M, opts *options.FindOptions) ([]memoryLogRecord, error) {
+	if desc, ok := firstByID(opts); ok {
+		return db.matchFirst(query, desc)
+	}
+
+	matched, err := db.match(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sortMemoryLogRecords(matched, opts.Sort); err != nil {
+		return nil, err
+	}
+
+	return matched, nil
+}
+
+func (db *MemoryLogStore) matchFirst(query bson.M, desc bool) ([]memoryLogRecord, error) {
+	q := normalizeBSONValue(query).(map[string]interface{}) //nolint:forcetypeassert //...
+
+	db.RLock()
+	defer db.RUnlock()
+
+	for i := range db.records {
+		j := i
+		if desc {
+			j = len(db.records) - i - 1
+		}
+
+		switch ok, err := matchBSONDocument(db.records[j].m, q); {
+		case err != nil:
+			return nil, err
+		case ok:
+			return []memoryLogRecord{db.records[j]}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// firstByID checks whether opts selects only the first one sorted by _id.
+func firstByID(opts *options.FindOptions) (desc, ok bool) {
+	switch {
+	case opts.Limit == nil || *opts.Limit != 1,
+		opts.Skip != nil && *opts.Skip > 0,
+		opts.Sort == nil:
+		return false, false
+	}
+
+	switch keys, err := sortBSONKeys(opts.Sort); {
+	case err != nil, len(keys) != 1, keys[0].Key != "_id":
+		return false, false
+	default:
+		order, _ := normalizeBSONValue(keys[0].Value).(float64)
+
+		return order < 0, true
+	}
+}
+
+func (db *MemoryLogStore) match(query bson.M) ([]memoryLogRecord, error) {
+	q := normalizeBSONValue(query).(map[string]interface{}) //nolint:forcetypeassert //...
+
+	db.RLock()
+	defer db.RUnlock()
+
+	var matched []memoryLogRecord
+
+	for i := range db.records {
+		switch ok, err := matchBSONDocument(db.records[i].m, q); {
+		case err != nil:
+			return nil, err
+		case ok:
+			matched = append(matched, db.records[i])
+		}
+	}
+
+	return matched, nil
+}
+
+func sortMemoryLogRecords(records []memoryLogRecord, i interface{}) error {
+	if i == nil {
+		return nil
+	}
+
+	keys, err := sortBSONKeys(i)
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return lessBSONDocument(records[i].m, records[j].m, keys)
+	})
+
+	return nil
+}
+
+func sortBSONKeys(i interface{}) (bson.D, error) {
+	switch t := i.(type) {
+	case bson.D:
+		return t, nil
+	case bson.M:
+		if len(t) > 1 {
+			return nil, errors.Errorf("multiple sort keys should be ordered, bson.D")
+		}
+
+		var keys bson.D
+
+		for k := range t {
+			keys = append(keys, bson.E{Key: k, Value: t[k]})
+		}
+
+		return keys, nil
+	default:
+		return nil, errors.Errorf("unknown sort type, %T", i)
+	}
+}
+
+// lessBSONDocument compares the normalized documents by the sort keys.
+func lessBSONDocument(a, b map[string]interface{}, keys bson.D) bool {
+	for k := range keys {
+		av, _ := lookupBSONValue(a, keys[k].Key)
+		bv, _ := lookupBSONValue(b, keys[k].Key)
+
+		c, _ := compareBSONValue(av, bv)
+		if c == 0 {
+			continue
+		}
+
+		if order, _ := normalizeBSONValue(keys[k].Value).(float64); order < 0 {
+			return c > 0
+		}
+
+		return c < 0
+	}
+
+	return false
+}
+
+func matchBSONDocument(doc, query map[string]interface{}) (bool, error) {
+	for k := range query {
+		var ok bool
+		var err error
+
+		switch k {
+		case "$and", "$or", "$nor":
+			ok, err = matchBSONLogical(doc, k, query[k])
+		default:
+			if strings.HasPrefix(k, "$") {
+				return false, errors.Errorf("unknown operator, %q", k)
+			}
+
+			ok, err = matchBSONField(doc, k, query[k])
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchBSONLogical(doc map[string]interface{}, op string, i interface{}) (bool, error) {
+	l, ok := i.([]interface{})
+	if !ok {
+		return false, errors.Errorf("%s should be array, not %T", op, i)
+	}
+
+	for j := range l {
+		q, ok := l[j].(map[string]interface{})
+		if !ok {
+			return false, errors.Errorf("%s should be array of document, not %T", op, l[j])
+		}
+
+		matched, err := matchBSONDocument(doc, q)
+
+		switch {
+		case err != nil:
+			return false, err
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+
+	return op != "$or", nil
+}
+
+func matchBSONField(doc map[string]interface{}, key string, cond interface{}) (bool, error) {
+	v, found := lookupBSONValue(doc, key)
+
+	ops, ok := cond.(map[string]interface{})
+	if !ok || !isBSONOperators(ops) {
+		if cond == nil && !found { // NOTE null matches the missing field
+			return true, nil
+		}
+
+		return found && equalBSONValue(v, cond), nil
+	}
+
+	for op := range ops {
+		ok, err := matchBSONOperator(v, found, op, ops[op], ops)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchBSONOperator( //revive:disable-line:cyclomatic
+	v interface{}, found bool, op string, arg interface{}, ops map[string]interface{},
+) (bool, error) {
+	switch op {
+	case "$eq":
+		return found && equalBSONValue(v, arg), nil
+	case "$ne":
+		return !found || !equalBSONValue(v, arg), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		if !found {
+			return false, nil
+		}
+
+		return anyBSONValue(v, func(i interface{}) bool {
+			c, ok := compareBSONValue(i, arg)
+			if !ok {
+				return false
+			}
+
+			switch op {
+			case "$gt":
+				return c > 0
+			case "$gte":
+				return c >= 0
+			case "$lt":
+				return c < 0
+			default:
+				return c <= 0
+			}
+		}), nil
+	case "$in", "$nin":
+		l, ok := arg.([]interface{})
+		if !ok {
+			return false, errors.Errorf("%s should be array, not %T", op, arg)
+		}
+
+		var in bool
+
+		for i := range l {
+			if found && equalBSONValue(v, l[i]) {
+				in = true
+
+				break
+			}
+		}
+
+		return in == (op == "$in"), nil
+	case "$exists":
+		exists, _ := arg.(bool)
+
+		return found == exists, nil
+	case "$regex":
+		return matchBSONRegex(v, found, arg, ops["$options"])
+	case "$options":
+		return true, nil
+	case "$not":
+		sub, ok := arg.(map[string]interface{})
+		if !ok || !isBSONOperators(sub) {
+			return false, errors.Errorf("$not should be operator expression")
+		}
+
+		for k := range sub {
+			ok, err := matchBSONOperator(v, found, k, sub[k], sub)
+			if err != nil {
+				return false, err
+			}
+
+			if !ok {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	default:
+		return false, errors.Errorf("unknown operator, %q", op)
+	}
+}
+
+// bsonRegexCache keeps the compiled $regex; the same query is matched
+// against every entry at every poll.
+var bsonRegexCache = util.NewLRUGCache[string, *regexp.Regexp](1 << 9) //nolint:mnd //...
+
+func compileBSONRegex(pattern string) (*regexp.Regexp, error) {
+	if re, found := bsonRegexCache.Get(pattern); found {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	bsonRegexCache.Set(pattern, re, 0)
+
+	return re, nil
+}
+
+func matchBSONRegex(v interface{}, found bool, arg, options interface{}) (bool, error) {
+	if !found {
+		return false, nil
+	}
+
+	var pattern, flags string
+
+	switch t := arg.(type) {
+	case string:
+		pattern = t
+	case primitive.Regex:
+		pattern, flags = t.Pattern, t.Options
+	default:
+		return false, errors.Errorf("$regex should be string, not %T", arg)
+	}
+
+	if s, ok := options.(string); ok {
+		flags = s
+	}
+
+	var prefix string
+
+	for _, c := range flags {
+		if strings.ContainsRune("imsx", c) {
+			prefix += string(c)
+		}
+	}
+
+	if len(prefix) > 0 {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+
+	re, err := compileBSONRegex(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return anyBSONValue(v, func(i interface{}) bool {
+		s, ok := i.(string)
+
+		return ok && re.MatchString(s)
+	}), nil
+}
+
+func isBSONOperators(m map[string]interface{}) bool {
+	if len(m) < 1 {
+		return false
+	}
+
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lookupBSONValue finds the value by dotted keys; for array, the values of
+// elements are collected.
+func lookupBSONValue(doc interface{}, keys string) (interface{}, bool) {
+	v := doc
+
+	ks := strings.Split(keys, ".")
+
+	for i := range ks {
+		switch t := v.(type) {
+		case primitive.M:
+			v = map[string]interface{}(t)
+		case primitive.D:
+			v = bsonDToMap(t)
+		case primitive.A:
+			v = []interface{}(t)
+		}
+
+		switch t := v.(type) {
+		case map[string]interface{}:
+			j, found := t[ks[i]]
+			if !found {
+				return nil, false
+			}
+
+			v = j
+		case []interface{}:
+			var l []interface{}
+
+			for j := range t {
+				if k, found := lookupBSONValue(t[j], strings.Join(ks[i:], ".")); found {
+					l = append(l, k)
+				}
+			}
+
+			return l, len(l) > 0
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+func bsonDToMap(d primitive.D) map[string]interface{} {
+	m := make(map[string]interface{}, len(d))
+
+	for i := range d {
+		m[d[i].Key] = d[i].Value
+	}
+
+	return m
+}
+
+func anyBSONValue(v interface{}, f func(interface{}) bool) bool {
+	if l, ok := v.([]interface{}); ok {
+		for i := range l {
+			if f(l[i]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return f(v)
+}
+
+func equalBSONValue(v, cond interface{}) bool {
+	if reflect.DeepEqual(v, cond) {
+		return true
+	}
+
+	if _, ok := cond.([]interface{}); ok {
+		return false
+	}
+
+	return anyBSONValue(v, func(i interface{}) bool {
+		return reflect.DeepEqual(i, cond)
+	})
+}
+
+// compareBSONValue compares the values of same kind; numbers, strings, times
+// and bools.
+func compareBSONValue(a, b interface{}) (int, bool) {
+	switch at := a.(type) {
+	case nil:
+		if b == nil {
+			return 0, true
+		}
+
+		return -1, false
+	case float64:
+		bt, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case at < bt:
+			return -1, true
+		case at > bt:
+			return 1, true
+		default:
+			return 0, true
+		}
+	case string:
+		bt, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+
+		return strings.Compare(at, bt), true
+	case time.Time:
+		bt, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+
+		return at.Compare(bt), true
+	case bool:
+		bt, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+
+		switch {
+		case at == bt:
+			return 0, true
+		case !at:
+			return -1, true
+		default:
+			return 1, true
+		}
+	default:
+		if b == nil {
+			return 1, false
+		}
+
+		return 0, false
+	}
+}
+
+// normalizeBSONValue converts the documents to map, arrays to slice, numbers
+// to float64 and times to time.Time in milliseconds like mongodb.
+func normalizeBSONValue(i interface{}) interface{} { //revive:disable-line:cyclomatic
+	switch t := i.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+
+		for k := range t {
+			m[k] = normalizeBSONValue(t[k])
+		}
+
+		return m
+	case primitive.M:
+		return normalizeBSONValue(map[string]interface{}(t))
+	case primitive.D:
+		return normalizeBSONValue(bsonDToMap(t))
+	case []interface{}:
+		l := make([]interface{}, len(t))
+
+		for j := range t {
+			l[j] = normalizeBSONValue(t[j])
+		}
+
+		return l
+	case primitive.A:
+		return normalizeBSONValue([]interface{}(t))
+	case []string:
+		l := make([]interface{}, len(t))
+
+		for j := range t {
+			l[j] = t[j]
+		}
+
+		return l
+	case int:
+		return float64(t)
+	case int32:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case uint:
+		return float64(t)
+	case uint32:
+		return float64(t)
+	case uint64:
+		return float64(t)
+	case float32:
+		return float64(t)
+	case time.Time:
+		return t.UTC().Truncate(time.Millisecond)
+	case primitive.DateTime:
+		return t.Time().UTC()
+	default:
+		return t
+	}
+}
@@ -0,0 +1,558 @@
+package contest
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Aggregate runs the aggregation pipeline; $match, $group, $sort, $limit,
+// $skip, $project, $unwind and $count stages are supported. $group supports
+// $sum, $count, $avg, $min, $max, $first, $last, $push and $addToSet.
+func (db *MemoryLogStore) Aggregate(ctx context.Context, pipeline bson.A) ([]map[string]interface{}, error) {
+	docs, err := func() ([]map[string]interface{}, error) {
+		db.RLock()
+		defer db.RUnlock()
+
+		docs := make([]map[string]interface{}, len(db.records))
+
+		for i := range db.records {
+			if err := bson.Unmarshal(db.records[i].raw, &docs[i]); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+
+		return docs, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pipeline {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		name, spec, err := aggregateStage(pipeline[i])
+		if err != nil {
+			return nil, errors.WithMessagef(err, "stage #%d", i)
+		}
+
+		docs, err = runAggregateStage(docs, name, spec)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "stage #%d, %s", i, name)
+		}
+	}
+
+	return docs, nil
+}
+
+func aggregateStage(i interface{}) (string, interface{}, error) {
+	var d bson.D
+
+	switch t := i.(type) {
+	case bson.D:
+		d = t
+	case bson.M:
+		for k := range t {
+			d = append(d, bson.E{Key: k, Value: t[k]})
+		}
+	case map[string]interface{}:
+		for k := range t {
+			d = append(d, bson.E{Key: k, Value: t[k]})
+		}
+	default:
+		return "", nil, errors.Errorf("stage should be document, not %T", i)
+	}
+
+	if len(d) != 1 {
+		return "", nil, errors.Errorf("stage should have one key, not %d", len(d))
+	}
+
+	return d[0].Key, d[0].Value, nil
+}
+
+func runAggregateStage( //revive:disable-line:cyclomatic
+	docs []map[string]interface{}, name string, spec interface{},
+) ([]map[string]interface{}, error) {
+	switch name {
+	case "$match":
+		q, ok := normalizeBSONValue(spec).(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("should be document, not %T", spec)
+		}
+
+		var matched []map[string]interface{}
+
+		for i := range docs {
+			switch ok, err := matchBSONDocument(normalizeBSONValue(docs[i]).(map[string]interface{}), q); { //nolint:forcetypeassert,lll //...
+			case err != nil:
+				return nil, err
+			case ok:
+				matched = append(matched, docs[i])
+			}
+		}
+
+		return matched, nil
+	case "$sort":
+		keys, err := sortBSONKeys(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		normalized := make([]map[string]interface{}, len(docs))
+		index := make([]int, len(docs))
+
+		for i := range docs {
+			normalized[i] = normalizeBSONValue(docs[i]).(map[string]interface{}) //nolint:forcetypeassert //...
+			index[i] = i
+		}
+
+		sort.SliceStable(index, func(i, j int) bool {
+			return lessBSONDocument(normalized[index[i]], normalized[index[j]], keys)
+		})
+
+		sorted := make([]map[string]interface{}, len(docs))
+
+		for i := range index {
+			sorted[i] = docs[index[i]]
+		}
+
+		return sorted, nil
+	case "$limit", "$skip":
+		f, ok := normalizeBSONValue(spec).(float64)
+		if !ok || f < 0 {
+			return nil, errors.Errorf("should be positive number, not %v", spec)
+		}
+
+		n := int(math.Min(f, float64(len(docs))))
+
+		if name == "$limit" {
+			return docs[:n], nil
+		}
+
+		return docs[n:], nil
+	case "$project":
+		projected := make([]map[string]interface{}, len(docs))
+
+		for i := range docs {
+			m, err := projectBSONDocument(docs[i], spec)
+			if err != nil {
+				return nil, err
+			}
+
+			projected[i] = m
+		}
+
+		return projected, nil
+	case "$unwind":
+		return unwindBSONDocuments(docs, spec)
+	case "$count":
+		field, ok := spec.(string)
+		if !ok || len(field) < 1 {
+			return nil, errors.Errorf("should be field name, not %v", spec)
+		}
+
+		if len(docs) < 1 {
+			return nil, nil
+		}
+
+		return []map[string]interface{}{{field: int32(len(docs))}}, nil //nolint:gosec //...
+	case "$group":
+		return groupBSONDocuments(docs, spec)
+	default:
+		return nil, errors.Errorf("unknown stage")
+	}
+}
+
+func unwindBSONDocuments(docs []map[string]interface{}, spec interface{}) ([]map[string]interface{}, error) {
+	path, ok := spec.(string)
+	if !ok {
+		m, isdoc := normalizeBSONValue(spec).(map[string]interface{})
+		if isdoc {
+			path, ok = m["path"].(string)
+		}
+	}
+
+	if !ok || !strings.HasPrefix(path, "$") {
+		return nil, errors.Errorf("should be field path, not %v", spec)
+	}
+
+	path = path[1:]
+
+	var unwound []map[string]interface{}
+
+	for i := range docs {
+		v, found := lookupBSONValue(docs[i], path)
+		if !found || v == nil {
+			continue
+		}
+
+		l, isarray := v.(bson.A)
+		if !isarray {
+			if j, isslice := v.([]interface{}); isslice {
+				l, isarray = j, true
+			}
+		}
+
+		if !isarray {
+			unwound = append(unwound, docs[i])
+
+			continue
+		}
+
+		for j := range l {
+			unwound = append(unwound, setBSONValue(docs[i], path, l[j]))
+		}
+	}
+
+	return unwound, nil
+}
+
+func groupBSONDocuments(docs []map[string]interface{}, spec interface{}) ([]map[string]interface{}, error) {
+	_, d, err := aggregateStage(bson.M{"$group": spec})
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := normalizeBSONValue(d).(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("should be document, not %T", d)
+	}
+
+	idexpr, found := m["_id"]
+	if !found {
+		return nil, errors.Errorf("_id is missing")
+	}
+
+	type accumulator struct {
+		arg   interface{}
+		field string
+		op    string
+	}
+
+	var accs []accumulator
+
+	for k := range m {
+		if k == "_id" {
+			continue
+		}
+
+		a, ok := m[k].(map[string]interface{})
+		if !ok || len(a) != 1 {
+			return nil, errors.Errorf("accumulator should be document with one operator, %q", k)
+		}
+
+		for op := range a {
+			switch op {
+			case "$sum", "$count", "$avg", "$min", "$max", "$first", "$last", "$push", "$addToSet":
+			default:
+				return nil, errors.Errorf("unknown accumulator, %q", op)
+			}
+
+			accs = append(accs, accumulator{field: k, op: op, arg: a[op]})
+		}
+	}
+
+	var keys []string
+
+	groups := map[string][]map[string]interface{}{}
+	ids := map[string]interface{}{}
+
+	for i := range docs {
+		id := evalAggregateExpr(docs[i], idexpr)
+
+		b, err := json.Marshal(normalizeBSONValue(id))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		k := string(b)
+
+		if _, found := groups[k]; !found {
+			keys = append(keys, k)
+			ids[k] = id
+		}
+
+		groups[k] = append(groups[k], docs[i])
+	}
+
+	grouped := make([]map[string]interface{}, len(keys))
+
+	for i := range keys {
+		g := map[string]interface{}{"_id": ids[keys[i]]}
+
+		for j := range accs {
+			g[accs[j].field] = accumulateBSONValues(groups[keys[i]], accs[j].op, accs[j].arg)
+		}
+
+		grouped[i] = g
+	}
+
+	return grouped, nil
+}
+
+func accumulateBSONValues( //revive:disable-line:cyclomatic
+	docs []map[string]interface{}, op string, arg interface{},
+) interface{} {
+	values := make([]interface{}, 0, len(docs))
+
+	for i := range docs {
+		if op == "$count" {
+			values = append(values, int32(1))
+
+			continue
+		}
+
+		if v := evalAggregateExpr(docs[i], arg); v != nil {
+			values = append(values, v)
+		}
+	}
+
+	switch op {
+	case "$sum", "$count", "$avg":
+		var sum float64
+		var n int
+
+		isint := true
+
+		for i := range values {
+			f, ok := normalizeBSONValue(values[i]).(float64)
+			if !ok {
+				continue
+			}
+
+			if f != math.Trunc(f) {
+				isint = false
+			}
+
+			sum += f
+			n++
+		}
+
+		switch {
+		case op == "$avg" && n < 1:
+			return nil
+		case op == "$avg":
+			return sum / float64(n)
+		case isint && sum <= math.MaxInt32 && sum >= math.MinInt32:
+			return int32(sum)
+		case isint:
+			return int64(sum)
+		default:
+			return sum
+		}
+	case "$min", "$max":
+		var r, nr interface{}
+
+		for i := range values {
+			n := normalizeBSONValue(values[i])
+
+			if r == nil {
+				r, nr = values[i], n
+
+				continue
+			}
+
+			c, ok := compareBSONValue(n, nr)
+			if ok && ((op == "$min" && c < 0) || (op == "$max" && c > 0)) {
+				r, nr = values[i], n
+			}
+		}
+
+		return r
+	case "$first", "$last":
+		if len(docs) < 1 {
+			return nil
+		}
+
+		if op == "$first" {
+			return evalAggregateExpr(docs[0], arg)
+		}
+
+		return evalAggregateExpr(docs[len(docs)-1], arg)
+	case "$push":
+		return bson.A(values)
+	default: // NOTE $addToSet
+		var set bson.A
+
+		for i := range values {
+			var found bool
+
+			for j := range set {
+				if equalBSONValue(normalizeBSONValue(set[j]), normalizeBSONValue(values[i])) {
+					found = true
+
+					break
+				}
+			}
+
+			if !found {
+				set = append(set, values[i])
+			}
+		}
+
+		return set
+	}
+}
+
+// evalAggregateExpr evaluates the expression; "$<path>" is the field value and
+// document is evaluated by fields. The other values are constant.
+func evalAggregateExpr(doc map[string]interface{}, expr interface{}) interface{} {
+	switch t := expr.(type) {
+	case string:
+		if !strings.HasPrefix(t, "$") {
+			return t
+		}
+
+		v, _ := lookupBSONValue(doc, t[1:])
+
+		return v
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+
+		for k := range t {
+			m[k] = evalAggregateExpr(doc, t[k])
+		}
+
+		return m
+	default:
+		return t
+	}
+}
+
+// projectBSONDocument projects document; inclusion with 1 or "$<path>",
+// exclusion with 0.
+func projectBSONDocument(doc map[string]interface{}, spec interface{}) (map[string]interface{}, error) {
+	p, ok := normalizeBSONValue(spec).(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("projection should be document, not %T", spec)
+	}
+
+	var include, exclude bool
+
+	for k := range p {
+		switch v := p[k].(type) {
+		case float64:
+			if v == 0 {
+				exclude = exclude || k != "_id"
+			} else {
+				include = true
+			}
+		case bool:
+			if v {
+				include = true
+			} else {
+				exclude = exclude || k != "_id"
+			}
+		default:
+			include = true
+		}
+	}
+
+	if include && exclude {
+		return nil, errors.Errorf("inclusion and exclusion can not be used together")
+	}
+
+	if exclude {
+		r := doc
+
+		for k := range p {
+			if _, found := lookupBSONValue(r, k); found {
+				r = setBSONValue(r, k, nil)
+				deleteBSONValue(r, k)
+			}
+		}
+
+		return r, nil
+	}
+
+	r := map[string]interface{}{"_id": doc["_id"]}
+
+	for k := range p {
+		var v interface{}
+		var found bool
+
+		switch t := p[k].(type) {
+		case float64:
+			if t == 0 {
+				delete(r, "_id")
+
+				continue
+			}
+
+			v, found = lookupBSONValue(doc, k)
+		case bool:
+			if !t {
+				delete(r, "_id")
+
+				continue
+			}
+
+			v, found = lookupBSONValue(doc, k)
+		default:
+			v, found = evalAggregateExpr(doc, t), true
+		}
+
+		if found {
+			r = setBSONValue(r, k, v)
+		}
+	}
+
+	return r, nil
+}
+
+// setBSONValue sets the value by dotted keys; the maps in path are copied.
+func setBSONValue(doc map[string]interface{}, keys string, v interface{}) map[string]interface{} {
+	r := make(map[string]interface{}, len(doc))
+
+	for k := range doc {
+		r[k] = doc[k]
+	}
+
+	ks := strings.SplitN(keys, ".", 2) //nolint:mnd //...
+
+	if len(ks) < 2 { //nolint:mnd //...
+		r[ks[0]] = v
+
+		return r
+	}
+
+	var sub map[string]interface{}
+
+	switch t := r[ks[0]].(type) {
+	case map[string]interface{}:
+		sub = t
+	case primitive.M:
+		sub = t
+	case primitive.D:
+		sub = bsonDToMap(t)
+	default:
+		sub = map[string]interface{}{}
+	}
+
+	r[ks[0]] = setBSONValue(sub, ks[1], v)
+
+	return r
+}
+
+func deleteBSONValue(doc map[string]interface{}, keys string) {
+	ks := strings.Split(keys, ".")
+
+	for i := range ks[:len(ks)-1] {
+		sub, ok := doc[ks[i]].(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		doc = sub
+	}
+
+	delete(doc, ks[len(ks)-1])
+}
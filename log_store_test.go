@@ -0,0 +1,433 @@
+package contest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type testMemoryLogStore struct {
+	suite.Suite
+	db *MemoryLogStore
+}
+
+func (t *testMemoryLogStore) SetupTest() {
+	t.db = NewMemoryLogStore()
+
+	var entries []LogEntry
+
+	entries = append(entries, NewInternalLogEntry("contest ready", nil))
+
+	for _, i := range []struct {
+		node string
+		x    bson.M
+	}{
+		{"no0", bson.M{"message": "state switched", "next_state": bson.M{"next": "SYNCING"}}},
+		{"no0", bson.M{"message": "new block saved", "height": 3}},
+		{"no1", bson.M{"message": "new block saved", "height": 4, "tags": bson.A{"a", "b"}}},
+		{"no1", bson.M{"message": "new block saved", "height": 5}},
+	} {
+		e, err := NewNodeLogEntryWithInterface(i.node, false, i.x)
+		t.NoError(err)
+
+		entries = append(entries, e)
+	}
+
+	t.NoError(t.db.InsertLogEntries(context.Background(), entries))
+}
+
+func (t *testMemoryLogStore) TestFind() {
+	ctx := context.Background()
+
+	cases := []struct {
+		name   string
+		query  string
+		height interface{}
+		found  bool
+	}{
+		{"equal", `{"node": "no0", "x.message": "new block saved"}`, int32(3), true},
+		{"latest", `{"x.message": "new block saved"}`, int32(5), true},
+		{"gt", `{"x.height": {"$gt": 3, "$lt": 5}}`, int32(4), true},
+		{"in", `{"node": {"$in": ["no2", "no0"]}, "x.height": {"$exists": true}}`, int32(3), true},
+		{"or", `{"$or": [{"x.height": 3}, {"x.height": 4}]}`, int32(4), true},
+		{"regex", `{"x.message": {"$regex": "^NEW", "$options": "i"}, "node": "no0"}`, int32(3), true},
+		{"array", `{"x.tags": "b"}`, int32(4), true},
+		{"not", `{"x.height": {"$not": {"$gte": 4}}, "node": "no1"}`, nil, false},
+		{"ne", `{"x.height": {"$ne": 5}, "node": "no1"}`, int32(4), true},
+		{"null", `{"node": null}`, nil, true},
+		{"not found", `{"node": "no2"}`, nil, false},
+	}
+
+	for _, c := range cases {
+		var m bson.M
+		t.NoError(bson.UnmarshalExtJSON([]byte(c.query), false, &m), c.name)
+
+		record, found, err := t.db.Find(ctx, m)
+		t.NoError(err, c.name)
+		t.Equal(c.found, found, c.name)
+
+		if c.height != nil {
+			height, _ := lookupBSONValue(record, "x.height")
+			t.Equal(c.height, height, c.name)
+		}
+	}
+
+	t.Run("unknown operator", func() {
+		_, _, err := t.db.Find(ctx, bson.M{"x.height": bson.M{"$where": "1"}})
+		t.Error(err)
+		t.ErrorContains(err, "unknown operator")
+	})
+
+	t.Run("regex compiled once", func() {
+		t.True(bsonRegexCache.Exists("(?i)^NEW"))
+	})
+
+	t.Run("first by _id", func() {
+		for _, c := range []struct {
+			order  int
+			height int32
+		}{{1, 3}, {-1, 5}} {
+			opts := options.Find().SetSort(bson.D{{Key: "_id", Value: c.order}}).SetLimit(1)
+
+			desc, ok := firstByID(opts)
+			t.True(ok)
+			t.Equal(c.order < 0, desc)
+
+			var records []map[string]interface{}
+
+			t.NoError(t.db.Traverse(ctx, bson.M{"x.height": bson.M{"$exists": true}}, opts,
+				func(m map[string]interface{}) (bool, error) {
+					records = append(records, m)
+
+					return true, nil
+				},
+			))
+
+			t.Equal(1, len(records))
+
+			height, _ := lookupBSONValue(records[0], "x.height")
+			t.Equal(c.height, height)
+		}
+
+		_, ok := firstByID(options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(2))
+		t.False(ok)
+
+		_, ok = firstByID(options.Find().SetSort(bson.D{{Key: "t", Value: -1}}).SetLimit(1))
+		t.False(ok)
+	})
+}
+
+func (t *testMemoryLogStore) TestCountAndTraverse() {
+	ctx := context.Background()
+
+	count, err := t.db.Count(ctx, bson.M{"x.message": "new block saved"})
+	t.NoError(err)
+	t.Equal(int64(3), count)
+
+	var records []map[string]interface{}
+
+	t.NoError(t.db.Traverse(ctx,
+		bson.M{"x.height": bson.M{"$exists": true}},
+		options.Find().
+			SetSort(bson.D{{Key: "node", Value: -1}, {Key: "x.height", Value: 1}}).
+			SetLimit(2).
+			SetProjection(bson.M{"x.height": 1}),
+		func(m map[string]interface{}) (bool, error) {
+			records = append(records, m)
+
+			return true, nil
+		},
+	))
+
+	t.Equal(2, len(records))
+	t.Equal(map[string]interface{}{"height": int32(4)}, records[0]["x"])
+	t.Equal(map[string]interface{}{"height": int32(5)}, records[1]["x"])
+	t.NotNil(records[0]["_id"])
+	t.Nil(records[0]["node"])
+}
+
+func (t *testMemoryLogStore) TestAggregate() {
+	var pipeline bson.A
+	t.NoError(bson.UnmarshalExtJSON([]byte(`[
+		{"$match": {"x.message": "new block saved"}},
+		{"$group": {"_id": "$node", "n": {"$sum": 1}, "max": {"$max": "$x.height"}, "heights": {"$addToSet": "$x.height"}}},
+		{"$sort": {"_id": 1}}
+	]`), false, &pipeline))
+
+	docs, err := t.db.Aggregate(context.Background(), pipeline)
+	t.NoError(err)
+	t.Equal(2, len(docs))
+
+	t.Equal("no0", docs[0]["_id"])
+	t.Equal(int32(1), docs[0]["n"])
+	t.Equal(int32(3), docs[0]["max"])
+
+	t.Equal("no1", docs[1]["_id"])
+	t.Equal(int32(2), docs[1]["n"])
+	t.Equal(int32(5), docs[1]["max"])
+	t.Equal(bson.A{int32(4), int32(5)}, docs[1]["heights"])
+
+	t.Run("unknown stage", func() {
+		_, err := t.db.Aggregate(context.Background(), bson.A{bson.M{"$lookup": bson.M{}}})
+		t.Error(err)
+		t.ErrorContains(err, "unknown stage")
+	})
+}
+
+func (t *testMemoryLogStore) TestIncrementalCount() {
+	ctx := context.Background()
+
+	w := NewWatchLogs(nil, nil, nil, nil, NewVars(nil), nil,
+		func(ctx context.Context, m bson.M) (interface{}, bool, error) {
+			return t.db.Find(ctx, m)
+		},
+		t.db.Count, t.db.Aggregate, nil, t.db.InsertLogEntries,
+	)
+
+	q, err := w.compileConditionQuery(map[string]interface{}{
+		"query": `{"x.message": "new block saved"}`,
+		"since": "previous_match",
+		"count": "== 5",
+	}, w.vars, nil)
+	t.NoError(err)
+
+	c, ok := q.(*IncrementalCountConditionQuery)
+	t.True(ok)
+
+	_, found, err := c.Find(ctx)
+	t.NoError(err)
+	t.False(found)
+	t.Zero(c.mark)
+
+	// NOTE pending entry takes the seq before the saved one, but inserted later.
+	pending := []LogEntry{NewInternalLogEntryWithX("new block saved", nil, bson.M{"message": "new block saved"})}
+	pendingSeq := w.inserted.pend(pending)
+
+	e, err := NewNodeLogEntryWithInterface("no1", false, bson.M{"message": "new block saved", "height": 6})
+	t.NoError(err)
+
+	entries := []LogEntry{e}
+	seq := w.inserted.pend(entries)
+	t.NoError(t.db.InsertLogEntries(ctx, entries))
+	w.inserted.done(seq)
+
+	_, found, err = c.Find(ctx)
+	t.NoError(err)
+	t.False(found)
+	t.Equal(pendingSeq, c.mark)
+
+	t.NoError(t.db.InsertLogEntries(ctx, pending))
+	w.inserted.done(pendingSeq)
+
+	_, found, err = c.Find(ctx)
+	t.NoError(err)
+	t.True(found)
+	t.Equal(seq+1, c.mark)
+}
+
+func (t *testMemoryLogStore) TestOutOfIDOrder() {
+	ctx := context.Background()
+
+	w := NewWatchLogs(nil, nil, nil, nil, NewVars(nil), nil,
+		func(ctx context.Context, m bson.M) (interface{}, bool, error) {
+			return t.db.Find(ctx, m)
+		},
+		t.db.Count, t.db.Aggregate, nil, t.db.InsertLogEntries,
+	)
+
+	save := func(entries ...LogEntry) {
+		seq := w.inserted.pend(entries)
+		t.NoError(t.db.InsertLogEntries(ctx, entries))
+		w.inserted.done(seq)
+	}
+
+	save(NewInternalLogEntry("contest started", nil))
+
+	// NOTE the log writers of nodes create the entries concurrently, so the
+	// older entry can be saved later.
+	newEntry := func(node, message string) []LogEntry {
+		older, err := NewNodeLogEntryWithInterface(node, false, bson.M{"message": message})
+		t.NoError(err)
+
+		newer, err := NewNodeLogEntryWithInterface("no0", false, bson.M{"message": "killme"})
+		t.NoError(err)
+
+		t.True(older.ID() < newer.ID())
+
+		return []LogEntry{older, newer}
+	}
+
+	t.Run("since", func() {
+		q, err := w.compileConditionQuery(map[string]interface{}{
+			"query": `{"x.message": "showme"}`,
+			"since": "previous_match",
+		}, w.vars, nil)
+		t.NoError(err)
+
+		entries := newEntry("no2", "showme")
+
+		save(entries[1])
+
+		_, found, err := q.Find(ctx)
+		t.NoError(err)
+		t.False(found)
+
+		save(entries[0])
+
+		r, found, err := q.Find(ctx)
+		t.NoError(err)
+		t.True(found)
+		t.Equal(entries[0].ID(), r.(map[string]interface{})["_id"])
+	})
+
+	t.Run("absent", func() {
+		q, err := w.compileConditionQuery(map[string]interface{}{
+			"absent": `{"x.message": "findme"}`,
+			"for":    "1m",
+		}, w.vars, nil)
+		t.NoError(err)
+
+		entries := newEntry("no3", "findme")
+
+		save(entries[1])
+
+		_, found, err := q.Find(ctx)
+		t.NoError(err)
+		t.False(found)
+
+		save(entries[0])
+
+		_, _, err = q.Find(ctx)
+		t.Error(err)
+		t.True(errors.Is(err, ErrConditionViolated))
+	})
+}
+
+func (t *testMemoryLogStore) TestWatchLogs() {
+	interval := time.Millisecond * 10
+
+	var actions []string
+
+	w := NewWatchLogs(
+		[]ExpectScenario{
+			{Condition: `{"msg": "contest ready"}`},
+			{
+				Condition: `{"node": "no1", "x.height": {"$gte": 5}}`,
+				Registers: []ScenarioRegister{{Type: "last_match", Assign: ".matched"}},
+				Actions:   []ScenarioAction{{Type: "a"}},
+			},
+			{Condition: map[string]interface{}{"query": `{"x.message": "new block saved"}`, "count": "== 3"}},
+			{Condition: map[string]interface{}{
+				"aggregate": `[{"$match": {"x.message": "new block saved"}}, {"$group": {"_id": "$node"}}]`,
+				"count":     "== 2",
+			}},
+			{Condition: `{"x.height": 4}`},
+			{Condition: map[string]interface{}{
+				"query": `{"x.message": "new block saved"}`,
+				"since": "previous_match",
+				"count": "== 1",
+			}},
+		},
+		nil,
+		make(chan LogEntry),
+		&interval,
+		NewVars(nil),
+		func(string) Host { return nil },
+		func(ctx context.Context, m bson.M) (interface{}, bool, error) {
+			return t.db.Find(ctx, m)
+		},
+		t.db.Count,
+		t.db.Aggregate,
+		func(_ context.Context, action ScenarioAction) error {
+			actions = append(actions, action.Type)
+
+			return nil
+		},
+		t.db.InsertLogEntries,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	t.NoError(<-w.Wait(ctx))
+	t.Equal([]string{"a"}, actions)
+
+	height, _ := w.vars.Value(".matched.x.height")
+	t.Equal(int32(5), height)
+
+	count, err := t.db.Count(context.Background(), bson.M{"msg": "expect matched"})
+	t.NoError(err)
+	t.Equal(int64(6), count)
+}
+
+func (t *testMemoryLogStore) TestWatchLogsPushed() {
+	interval := time.Minute
+	savelogch := make(chan LogEntry)
+
+	var actions []string
+
+	w := NewWatchLogs(
+		[]ExpectScenario{
+			{
+				Condition: `{"node": "no2", "x.message": {"$regex": "^stop"}}`,
+				Actions:   []ScenarioAction{{Type: "stop"}},
+			},
+		},
+		nil,
+		savelogch,
+		&interval,
+		NewVars(nil),
+		func(string) Host { return nil },
+		func(ctx context.Context, m bson.M) (interface{}, bool, error) {
+			return t.db.Find(ctx, m)
+		},
+		t.db.Count,
+		t.db.Aggregate,
+		func(_ context.Context, action ScenarioAction) error {
+			actions = append(actions, action.Type)
+
+			return nil
+		},
+		t.db.InsertLogEntries,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	errch := w.Wait(ctx)
+
+	<-time.After(time.Millisecond * 100)
+
+	for _, node := range []string{"no1", "no2"} {
+		e, err := NewNodeLogEntryWithInterface(node, false, bson.M{"message": "stop now"})
+		t.NoError(err)
+
+		savelogch <- e
+	}
+
+	select {
+	case err := <-errch:
+		t.NoError(err)
+	case <-time.After(time.Second):
+		t.Fail("not matched by pushed entry")
+	}
+
+	t.Equal([]string{"stop"}, actions)
+
+	results := w.Results()
+	t.Equal(1, len(results))
+	t.Equal(1, len(results[0].Records))
+
+	record, ok := results[0].Records[0].(map[string]interface{})
+	t.True(ok)
+	t.Equal("no2", record["node"])
+}
+
+func TestMemoryLogStore(t *testing.T) {
+	suite.Run(t, new(testMemoryLogStore))
+}
@@ -0,0 +1,636 @@
+package contest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type testWatchLogs struct {
+	suite.Suite
+	msgs    map[string]struct{}
+	actions []string
+	events  []InternalLogEntry
+	sync.Mutex
+}
+
+func (t *testWatchLogs) SetupTest() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.msgs = map[string]struct{}{}
+	t.actions = nil
+	t.events = nil
+}
+
+func (t *testWatchLogs) addMsg(msg string) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.msgs[msg] = struct{}{}
+}
+
+func (t *testWatchLogs) doneActions() []string {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.actions
+}
+
+// findMsg finds the msg of query; the _id range of query is ignored.
+func (t *testWatchLogs) findMsg(m bson.M) (string, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	for {
+		i, found := m["$and"]
+		if !found {
+			break
+		}
+
+		m = i.(bson.A)[0].(bson.M)
+	}
+
+	msg, _ := m["msg"].(string)
+	_, found := t.msgs[msg]
+
+	return msg, found
+}
+
+func (t *testWatchLogs) newWatchLogs(expects []ExpectScenario, invariants ...Invariant) *WatchLogs {
+	interval := time.Millisecond * 10
+
+	return NewWatchLogs(
+		expects,
+		invariants,
+		make(chan LogEntry),
+		&interval,
+		NewVars(nil),
+		func(string) Host { return nil },
+		func(_ context.Context, m bson.M) (interface{}, bool, error) {
+			msg, found := t.findMsg(m)
+			if !found {
+				return nil, false, nil
+			}
+
+			return map[string]interface{}{"msg": msg}, true, nil
+		},
+		func(_ context.Context, m bson.M) (int64, error) {
+			if _, found := t.findMsg(m); found {
+				return 1, nil
+			}
+
+			return 0, nil
+		},
+		func(context.Context, bson.A) ([]map[string]interface{}, error) {
+			return nil, errors.Errorf("aggregate not supported")
+		},
+		func(_ context.Context, action ScenarioAction) error {
+			t.Lock()
+			defer t.Unlock()
+
+			t.actions = append(t.actions, action.Type)
+
+			return nil
+		},
+		func(_ context.Context, entries []LogEntry) error {
+			t.Lock()
+			defer t.Unlock()
+
+			for i := range entries {
+				if e, ok := entries[i].(InternalLogEntry); ok {
+					t.events = append(t.events, e)
+				}
+			}
+
+			return nil
+		},
+	)
+}
+
+func (t *testWatchLogs) expect(msg, action string) ExpectScenario {
+	e := ExpectScenario{Condition: `{"msg": "` + msg + `"}`}
+
+	if len(action) > 0 {
+		e.Actions = []ScenarioAction{{Type: action}}
+	}
+
+	return e
+}
+
+func (t *testWatchLogs) TestParallelJoinAll() {
+	w := t.newWatchLogs([]ExpectScenario{
+		t.expect("ready", "a"),
+		{Parallel: &ExpectParallel{
+			Tracks: []ExpectTrack{
+				{Name: "x", Expects: []ExpectScenario{t.expect("x0", "x0"), t.expect("x1", "x1")}},
+				{Name: "y", Expects: []ExpectScenario{t.expect("y0", "y0")}},
+			},
+		}},
+		t.expect("ready", "b"),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	t.addMsg("ready")
+	t.addMsg("x0")
+
+	errch := w.Wait(ctx)
+
+	<-time.After(time.Millisecond * 100)
+	t.Equal([]string{"a", "x0"}, t.doneActions())
+
+	t.addMsg("y0")
+
+	<-time.After(time.Millisecond * 100)
+	t.Equal([]string{"a", "x0", "y0"}, t.doneActions())
+
+	t.addMsg("x1")
+
+	t.NoError(<-errch)
+	t.Equal([]string{"a", "x0", "y0", "x1", "b"}, t.doneActions())
+}
+
+func (t *testWatchLogs) TestParallelJoinAny() {
+	w := t.newWatchLogs([]ExpectScenario{
+		{Parallel: &ExpectParallel{
+			Join: ExpectJoinAny,
+			Tracks: []ExpectTrack{
+				{Expects: []ExpectScenario{t.expect("x0", "x0")}},
+				{Expects: []ExpectScenario{t.expect("y0", "y0")}},
+			},
+		}},
+		t.expect("y0", "b"),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	t.addMsg("y0")
+
+	t.NoError(<-w.Wait(ctx))
+	t.Equal([]string{"y0", "b"}, t.doneActions())
+}
+
+func (t *testWatchLogs) TestTimeout() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	t.Run("error", func() {
+		e := t.expect("x0", "x0")
+		e.Timeout = time.Millisecond * 50
+
+		w := t.newWatchLogs([]ExpectScenario{t.expect("ready", ""), e})
+
+		t.addMsg("ready")
+
+		err := <-w.Wait(ctx)
+		t.Error(err)
+		t.ErrorContains(err, "expect #1 timed out")
+		t.ErrorContains(err, `"x0"`)
+	})
+
+	t.Run("on_timeout", func() {
+		e := t.expect("x0", "x0")
+		e.Timeout = time.Millisecond * 50
+		e.OnTimeout = []ScenarioAction{{Type: "collect"}}
+
+		w := t.newWatchLogs([]ExpectScenario{e, t.expect("ready", "b")})
+
+		t.NoError(<-w.Wait(ctx))
+		t.Equal([]string{"collect", "b"}, t.doneActions())
+	})
+}
+
+func (t *testWatchLogs) TestAbsent() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	t.Run("passed", func() {
+		w := t.newWatchLogs([]ExpectScenario{
+			{Condition: map[string]interface{}{"absent": `{"msg": "stuck"}`, "for": "50ms"}},
+			t.expect("ready", "b"),
+		})
+
+		t.addMsg("ready")
+
+		t.NoError(<-w.Wait(ctx))
+		t.Equal([]string{"b"}, t.doneActions())
+	})
+
+	t.Run("timeout", func() {
+		t.SetupTest()
+
+		w := t.newWatchLogs([]ExpectScenario{
+			{
+				Condition: map[string]interface{}{"absent": `{"msg": "stuck"}`, "until": `{"msg": "synced"}`},
+				Timeout:   time.Millisecond * 50,
+			},
+			t.expect("ready", "b"),
+		})
+
+		t.addMsg("ready")
+
+		t.NoError(<-w.Wait(ctx))
+		t.Equal([]string{"b"}, t.doneActions())
+		t.Equal(ExpectResultMatched, w.Results()[0].Status)
+	})
+
+	t.Run("never until finished", func() {
+		t.SetupTest()
+
+		w := t.newWatchLogs([]ExpectScenario{
+			{Condition: map[string]interface{}{"never": `{"msg": "stuck"}`}},
+			t.expect("ready", "b"),
+		})
+
+		errch := w.Wait(ctx)
+
+		<-time.After(time.Millisecond * 50)
+		t.addMsg("ready")
+
+		t.NoError(<-errch)
+		t.Equal([]string{"b"}, t.doneActions())
+
+		results := w.Results()
+		t.Equal(2, len(results))
+		t.Equal(ExpectResultMatched, results[0].Status)
+		t.Equal(ExpectResultMatched, results[1].Status)
+	})
+
+	t.Run("violated", func() {
+		t.SetupTest()
+
+		w := t.newWatchLogs([]ExpectScenario{
+			{Condition: map[string]interface{}{"never": `{"msg": "stuck"}`}},
+			t.expect("ready", "b"),
+		})
+
+		errch := w.Wait(ctx)
+
+		<-time.After(time.Millisecond * 50)
+		t.addMsg("stuck")
+
+		err := <-errch
+		t.Error(err)
+		t.True(errors.Is(err, ErrConditionViolated), "%+v", err)
+		t.Empty(t.doneActions())
+
+		for _, r := range w.Results() {
+			switch r.Path {
+			case "0":
+				t.Equal(ExpectResultFailed, r.Status)
+			case "1":
+				t.Equal(ExpectResultCanceled, r.Status)
+			}
+		}
+	})
+
+	t.Run("on_fail", func() {
+		t.SetupTest()
+
+		w := t.newWatchLogs([]ExpectScenario{
+			{
+				Condition: map[string]interface{}{"absent": `{"msg": "stuck"}`, "for": "1m"},
+				OnFail:    &ExpectFlow{Actions: []ScenarioAction{{Type: "collect"}}},
+			},
+			t.expect("ready", "b"),
+		})
+
+		t.addMsg("ready")
+
+		errch := w.Wait(ctx)
+
+		<-time.After(time.Millisecond * 50)
+		t.addMsg("stuck")
+
+		t.NoError(<-errch)
+		t.Equal([]string{"collect", "b"}, t.doneActions())
+		t.Equal(ExpectResultFailed, w.Results()[0].Status)
+	})
+
+	t.Run("never goto", func() {
+		e := ExpectScenario{
+			Condition: map[string]interface{}{"never": `{"msg": "stuck"}`},
+			OnFail:    &ExpectFlow{Goto: "end"},
+		}
+
+		err := e.IsValid(nil)
+		t.Error(err)
+		t.ErrorContains(err, "goto is not allowed")
+	})
+
+	t.Run("if_condition_failed", func() {
+		for _, k := range []string{"absent", "never"} {
+			e := ExpectScenario{
+				Condition:         map[string]interface{}{k: `{"msg": "stuck"}`},
+				IfConditionFailed: IfConditionFailedStopContest,
+			}
+
+			err := e.IsValid(nil)
+			t.Error(err, k)
+			t.ErrorContains(err, "if_condition_failed of absent or never", k)
+		}
+	})
+}
+
+func (t *testWatchLogs) TestClock() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	var l sync.Mutex
+
+	now := time.Now()
+	started := now
+
+	forward := func(d time.Duration) {
+		l.Lock()
+		defer l.Unlock()
+
+		now = now.Add(d)
+	}
+
+	timeout := t.expect("x0", "")
+	timeout.Timeout = time.Minute
+	timeout.OnTimeout = []ScenarioAction{{Type: "collect"}}
+
+	w := t.newWatchLogs([]ExpectScenario{
+		timeout,
+		{Condition: map[string]interface{}{"absent": `{"msg": "stuck"}`, "for": "1m"}},
+		t.expect("ready", "b"),
+	})
+
+	_ = w.SetClock(func() time.Time {
+		l.Lock()
+		defer l.Unlock()
+
+		return now
+	})
+
+	t.addMsg("ready")
+
+	errch := w.Wait(ctx)
+
+	<-time.After(time.Millisecond * 100)
+	t.Empty(t.doneActions())
+
+	forward(time.Minute)
+
+	<-time.After(time.Millisecond * 100)
+	t.Equal([]string{"collect"}, t.doneActions())
+
+	forward(time.Minute)
+
+	t.NoError(<-errch)
+	t.Equal([]string{"collect", "b"}, t.doneActions())
+
+	results := w.Results()
+	t.Equal(ExpectResultTimedOut, results[0].Status)
+	t.Equal(started, results[0].Started)
+	t.Equal(time.Minute, results[0].Duration())
+	t.Equal(started.Add(time.Minute), results[0].Actions[0].Time)
+}
+
+func (t *testWatchLogs) TestInvariant() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	w := t.newWatchLogs(
+		[]ExpectScenario{t.expect("ready", "b")},
+		Invariant{Name: "no error", Condition: `{"msg": "error"}`},
+	)
+
+	errch := w.Wait(ctx)
+
+	<-time.After(time.Millisecond * 50)
+	t.addMsg("error")
+	<-time.After(time.Millisecond * 50)
+	t.addMsg("ready")
+
+	t.NoError(<-errch)
+	t.Equal([]string{"stop-contest", "b"}, t.doneActions())
+}
+
+func (t *testWatchLogs) TestFlow() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	newexpects := func() []ExpectScenario {
+		check := t.expect("accepted", "")
+		check.OnMatch = &ExpectFlow{Goto: "accepted"}
+		check.OnFail = &ExpectFlow{Goto: "canceled", Actions: []ScenarioAction{{Type: "failed"}}}
+
+		accepted := t.expect("ready", "accepted")
+		accepted.Label = "accepted"
+		accepted.OnMatch = &ExpectFlow{Goto: "end"}
+
+		canceled := t.expect("ready", "canceled")
+		canceled.Label = "canceled"
+
+		end := t.expect("ready", "end")
+		end.Label = "end"
+
+		return []ExpectScenario{t.expect("ready", ""), check, accepted, canceled, end}
+	}
+
+	t.Run("on_fail", func() {
+		t.SetupTest()
+		t.addMsg("ready")
+
+		t.NoError(isValidExpectsFlow(newexpects()))
+
+		w := t.newWatchLogs(newexpects())
+
+		t.NoError(<-w.Wait(ctx))
+		t.Equal([]string{"failed", "canceled", "end"}, t.doneActions())
+	})
+
+	t.Run("on_match", func() {
+		t.SetupTest()
+		t.addMsg("ready")
+		t.addMsg("accepted")
+
+		w := t.newWatchLogs(newexpects())
+
+		t.NoError(<-w.Wait(ctx))
+		t.Equal([]string{"accepted", "end"}, t.doneActions())
+	})
+
+	t.Run("unknown label", func() {
+		expects := newexpects()
+		expects[1].OnFail.Goto = "unknown"
+
+		err := isValidExpectsFlow(expects)
+		t.Error(err)
+		t.ErrorContains(err, "goto label not found")
+
+		err = ExpectTrack{Expects: expects}.IsValid(nil)
+		t.Error(err)
+		t.ErrorContains(err, "goto label not found")
+	})
+
+	t.Run("duplicated label in track", func() {
+		expects := newexpects()
+		expects[3].Label = "accepted"
+
+		err := ExpectTrack{Expects: expects}.IsValid(nil)
+		t.Error(err)
+		t.ErrorContains(err, "duplicated label")
+	})
+}
+
+func (t *testWatchLogs) TestRepeat() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	t.Run("count", func() {
+		t.SetupTest()
+		t.addMsg("x0")
+		t.addMsg("x1")
+		t.addMsg("x2")
+
+		w := t.newWatchLogs([]ExpectScenario{
+			{Repeat: &ExpectRepeat{
+				Count:   3,
+				Expects: []ExpectScenario{t.expect("x{{ .loop.index }}", "x")},
+			}},
+			t.expect("x0", "b"),
+		})
+
+		t.NoError(<-w.Wait(ctx))
+		t.Equal([]string{"x", "x", "x", "b"}, t.doneActions())
+	})
+
+	t.Run("until", func() {
+		t.SetupTest()
+		t.addMsg("x0")
+		t.addMsg("x1")
+		t.addMsg("stop1")
+
+		w := t.newWatchLogs([]ExpectScenario{
+			{Repeat: &ExpectRepeat{
+				Until:   `{"msg": "stop{{ .loop.index }}"}`,
+				Expects: []ExpectScenario{t.expect("x{{ .loop.index }}", "x")},
+			}},
+		})
+
+		t.NoError(<-w.Wait(ctx))
+		t.Equal([]string{"x", "x"}, t.doneActions())
+		t.False(w.vars.Exists(".loop"))
+	})
+
+	t.Run("parallel", func() {
+		t.SetupTest()
+
+		for _, msg := range []string{"x0", "x1", "x2", "y0", "y1", "y2"} {
+			t.addMsg(msg)
+		}
+
+		repeat := func(name string) ExpectTrack {
+			return ExpectTrack{Name: name, Expects: []ExpectScenario{{Repeat: &ExpectRepeat{
+				Count: 3,
+				Expects: []ExpectScenario{
+					t.expect(name+"{{ .loop.index }}", ""),
+					t.expect(name+"{{ .loop.index }}", ""),
+				},
+			}}}}
+		}
+
+		w := t.newWatchLogs([]ExpectScenario{
+			{Parallel: &ExpectParallel{Tracks: []ExpectTrack{repeat("x"), repeat("y")}}},
+		})
+
+		t.NoError(<-w.Wait(ctx))
+		t.False(w.vars.Exists(".loop"))
+
+		for _, r := range w.Results() {
+			if len(r.Queries) < 1 {
+				continue
+			}
+
+			// NOTE path is 0/<track>/0/loop<index>/<expect>
+			p := strings.Split(r.Path, "/")
+
+			t.Equal(`{"msg":"`+p[1]+strings.TrimPrefix(p[3], "loop")+`"}`, r.Queries[0], r.Path)
+		}
+	})
+}
+
+func (t *testWatchLogs) TestResults() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	t.addMsg("ready")
+
+	timeout := t.expect("x0", "")
+	timeout.Timeout = time.Millisecond * 50
+	timeout.OnTimeout = []ScenarioAction{{Type: "collect"}}
+
+	matched := t.expect("ready", "a")
+	matched.Label = "ready"
+	matched.Registers = []ScenarioRegister{{Type: "last_match", Assign: ".ready"}}
+
+	w := t.newWatchLogs([]ExpectScenario{matched, timeout})
+
+	t.NoError(<-w.Wait(ctx))
+
+	results := w.Results()
+	t.Equal(2, len(results))
+
+	t.Equal("0", results[0].Path)
+	t.Equal("ready", results[0].Label)
+	t.Equal(ExpectResultMatched, results[0].Status)
+	t.Equal([]string{`{"msg":"ready"}`}, results[0].Queries)
+	t.Equal([]interface{}{map[string]interface{}{"msg": "ready"}}, results[0].Records)
+	t.Equal(map[string]interface{}{"msg": "ready"}, results[0].Registered[".ready"])
+	t.Equal(1, len(results[0].Actions))
+	t.Equal("a", results[0].Actions[0].Type)
+	t.Equal("match", results[0].Actions[0].Trigger)
+	t.False(results[0].Actions[0].Time.IsZero())
+
+	t.Equal("1", results[1].Path)
+	t.Equal(ExpectResultTimedOut, results[1].Status)
+	t.Equal(1, len(results[1].Actions))
+	t.Equal("collect", results[1].Actions[0].Type)
+	t.Equal("on_timeout", results[1].Actions[0].Trigger)
+	t.True(results[1].Duration() >= timeout.Timeout)
+
+	t.Run("events", func() {
+		t.Lock()
+		defer t.Unlock()
+
+		msgs := make([]string, len(t.events))
+
+		for i := range t.events {
+			msgs[i] = t.events[i].x["expect"].(string) + " " + t.events[i].msg
+		}
+
+		t.Equal([]string{
+			"0 expect started",
+			"0 expect registered",
+			"0 expect action started",
+			"0 expect action finished",
+			"0 expect matched",
+			"1 expect started",
+			"1 expect action started",
+			"1 expect action finished",
+			"1 expect timed_out",
+		}, msgs)
+
+		t.Equal(".ready", t.events[1].x["assign"])
+		t.Equal("match", t.events[3].x["trigger"])
+		t.Equal("ready", t.events[4].x["label"])
+		t.Equal("on_timeout", t.events[7].x["trigger"])
+	})
+}
+
+func TestWatchLogs(t *testing.T) {
+	suite.Run(t, new(testWatchLogs))
+}
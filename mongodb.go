@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 
 	"github.com/FerretDB/FerretDB/ferretdb"
 	"github.com/pkg/errors"
@@ -29,6 +30,33 @@ var logEntryIndexModel = []mongo.IndexModel{
 		Keys:    bson.D{bson.E{Key: "error", Value: 1}},
 		Options: options.Index().SetName(mongodbIndexPrefix + "_error"),
 	},
+	{
+		Keys:    bson.D{bson.E{Key: "t", Value: 1}},
+		Options: options.Index().SetName(mongodbIndexPrefix + "_t"),
+	},
+	{
+		Keys:    bson.D{bson.E{Key: "seq", Value: 1}},
+		Options: options.Index().SetName(mongodbIndexPrefix + "_seq"),
+	},
+	{
+		Keys:    bson.D{bson.E{Key: "msg", Value: 1}},
+		Options: options.Index().SetName(mongodbIndexPrefix + "_msg"),
+	},
+	{
+		Keys:    bson.D{bson.E{Key: "stderr", Value: 1}},
+		Options: options.Index().SetName(mongodbIndexPrefix + "_stderr"),
+	},
+	{
+		Keys: bson.D{
+			bson.E{Key: "x.message", Value: 1},
+			bson.E{Key: "node", Value: 1},
+		},
+		Options: options.Index().SetName(mongodbIndexPrefix + "_x_message_node"),
+	},
+	{
+		Keys:    bson.D{bson.E{Key: "x.height", Value: 1}},
+		Options: options.Index().SetName(mongodbIndexPrefix + "_x_height"),
+	},
 }
 
 func RunFerretDB(ctx context.Context, sock, db string, logger *slog.Logger) error {
@@ -53,11 +81,18 @@ func RunFerretDB(ctx context.Context, sock, db string, logger *slog.Logger) erro
 }
 
 type Mongodb struct {
-	client *mongo.Client
-	db     *mongo.Database
+	client           *mongo.Client
+	db               *mongo.Database
+	countUnsupported *atomic.Bool
 }
 
 func NewMongodbFromURI(ctx context.Context, uri string) (*Mongodb, error) {
+	return NewMongodbFromURIWithDatabase(ctx, uri, "")
+}
+
+// NewMongodbFromURIWithDatabase connects to mongodb; if database is not empty,
+// it overrides the database of uri.
+func NewMongodbFromURIWithDatabase(ctx context.Context, uri, database string) (*Mongodb, error) {
 	e := util.StringError("connect mongodb")
 
 	cs, err := connstring.Parse(uri)
@@ -65,7 +100,15 @@ func NewMongodbFromURI(ctx context.Context, uri string) (*Mongodb, error) {
 		return nil, e.Wrap(err)
 	}
 
-	db := &Mongodb{}
+	if len(database) > 0 {
+		cs.Database = database
+	}
+
+	if len(cs.Database) < 1 {
+		return nil, e.Errorf("empty database")
+	}
+
+	db := &Mongodb{countUnsupported: &atomic.Bool{}}
 
 	if err := db.connect(ctx, cs); err != nil {
 		return nil, e.WithMessage(err, "")
@@ -137,9 +180,22 @@ func (db *Mongodb) Find(ctx context.Context, query bson.M) (record map[string]in
 	}
 }
 
+// Count counts the entries by CountDocuments; if the backend does not support
+// it, the entries are counted by iterating cursor.
 func (db *Mongodb) Count(ctx context.Context, query bson.M) (count int64, _ error) {
-	// NOTE ferretdb does not support CountDocuments yet.
-	// i, err := db.db.Collection(mongodbColLogEntry).CountDocuments(ctx, query, nil)
+	if !db.countUnsupported.Load() {
+		i, err := db.db.Collection(mongodbColLogEntry).CountDocuments(ctx, query)
+
+		switch {
+		case err == nil:
+			return i, nil
+		case !isMongodbNotSupportedError(err):
+			return 0, errors.WithStack(err)
+		default:
+			db.countUnsupported.Store(true)
+		}
+	}
+
 	cur, err := db.db.Collection(mongodbColLogEntry).Find(ctx, query)
 	if err != nil {
 		return count, errors.WithStack(err)
@@ -156,10 +212,120 @@ func (db *Mongodb) Count(ctx context.Context, query bson.M) (count int64, _ erro
 	return count, nil
 }
 
+// Aggregate runs the aggregation pipeline over the log entries.
+func (db *Mongodb) Aggregate(ctx context.Context, pipeline bson.A) ([]map[string]interface{}, error) {
+	cur, err := db.db.Collection(mongodbColLogEntry).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var records []map[string]interface{}
+
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return records, nil
+}
+
+// Traverse iterates the log entries, which are matched with query; without
+// sort option, they are sorted by _id. If f returns false, it stops.
+func (db *Mongodb) Traverse(
+	ctx context.Context,
+	query bson.M,
+	opts *options.FindOptions,
+	f func(map[string]interface{}) (bool, error),
+) error {
+	option := opts
+	if option == nil {
+		option = options.Find()
+	}
+
+	if option.Sort == nil {
+		option = option.SetSort(bson.D{{Key: "_id", Value: 1}})
+	}
+
+	cur, err := db.db.Collection(mongodbColLogEntry).Find(ctx, query, option)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() {
+		_ = cur.Close(ctx)
+	}()
+
+	for cur.Next(ctx) {
+		var record map[string]interface{}
+
+		if err := cur.Decode(&record); err != nil {
+			return errors.WithStack(err)
+		}
+
+		switch keep, err := f(record); {
+		case err != nil:
+			return err
+		case !keep:
+			return nil
+		}
+	}
+
+	return errors.WithStack(cur.Err())
+}
+
+// CreateIndexes creates the additional indexes of log entries; the existing
+// indexes by name are ignored.
+func (db *Mongodb) CreateIndexes(ctx context.Context, models []mongo.IndexModel) error {
+	return db.createIndices(ctx, mongodbColLogEntry, models)
+}
+
+func isMongodbNotSupportedError(err error) bool {
+	var cerr mongo.CommandError
+
+	if !errors.As(err, &cerr) {
+		return false
+	}
+
+	switch cerr.Code {
+	case 59, 115, 238: //nolint:mnd // CommandNotFound, CommandNotSupported, NotImplemented
+		return true
+	default:
+		return false
+	}
+}
+
 func (db *Mongodb) createIndices(ctx context.Context, col string, models []mongo.IndexModel) error {
 	iv := db.db.Collection(col).Indexes()
 
-	if _, err := iv.CreateMany(ctx, models); err != nil {
+	// NOTE ferretdb panics when creating the existing indexes, so only the
+	// missing indexes are created.
+	specs, err := iv.ListSpecifications(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	existing := map[string]struct{}{}
+
+	for i := range specs {
+		existing[specs[i].Name] = struct{}{}
+	}
+
+	var missing []mongo.IndexModel
+
+	for i := range models {
+		if models[i].Options != nil && models[i].Options.Name != nil {
+			if _, found := existing[*models[i].Options.Name]; found {
+				continue
+			}
+		}
+
+		missing = append(missing, models[i])
+	}
+
+	if len(missing) < 1 {
+		return nil
+	}
+
+	if _, err := iv.CreateMany(ctx, missing); err != nil {
 		return errors.WithStack(err)
 	}
 
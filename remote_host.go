@@ -126,6 +126,22 @@ func (h *RemoteHost) Upload(s io.Reader, name, dest string, mode os.FileMode) er
 	return nil
 }
 
+func (h *RemoteHost) Link(source, name, dest string) error {
+	e := util.StringError("link")
+
+	newdest := filepath.Join(h.base, dest)
+
+	if _, _, err := h.runCommand(
+		fmt.Sprintf(`ln -f '%[1]s' '%[2]s' 2>/dev/null || cp -pf '%[1]s' '%[2]s'`, source, newdest),
+	); err != nil {
+		return e.Wrap(err)
+	}
+
+	h.addFile(name, newdest)
+
+	return nil
+}
+
 func (h *RemoteHost) upload(s io.Reader, _, dest string) error {
 	session, err := h.sshSession()
 	if err != nil {
@@ -9,6 +9,10 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/spikeekips/mitum/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
 )
 
 type Design struct {
@@ -16,6 +20,9 @@ type Design struct {
 	Designs                     NodeDesigns            `yaml:"designs"`
 	Expects                     []ExpectScenario       `yaml:"expects"`
 	Nodes                       NodesDesign            `yaml:"nodes"`
+	Invariants                  []Invariant            `yaml:"invariants"`
+	Matrix                      DesignMatrix           `yaml:"matrix"`
+	Indexes                     []DesignIndex          `yaml:"indexes"`
 	IgnoreAbnormalContainerExit bool                   `yaml:"ignore_abnormal_container_exit"`
 }
 
@@ -30,12 +37,38 @@ func (s Design) IsValid(b []byte) error {
 		return e.Errorf("empty expects")
 	}
 
+	if err := isValidExpectsFlow(s.Expects); err != nil {
+		return e.Wrap(err)
+	}
+
 	for i := range s.Expects {
 		if err := s.Expects[i].IsValid(b); err != nil {
 			return e.Wrap(err)
 		}
 	}
 
+	for i := range s.Invariants {
+		if err := s.Invariants[i].IsValid(b); err != nil {
+			return e.WithMessage(err, "invariant %d", i)
+		}
+	}
+
+	if err := s.Matrix.IsValid(b); err != nil {
+		return e.Wrap(err)
+	}
+
+	for i := range s.Indexes {
+		if err := s.Indexes[i].IsValid(b); err != nil {
+			return e.WithMessage(err, "index %d", i)
+		}
+	}
+
+	if util.IsDuplicatedSlice(s.Indexes, func(i DesignIndex) (bool, string) {
+		return true, i.IndexName()
+	}) {
+		return e.Errorf("duplicated index names found")
+	}
+
 	if util.IsDuplicatedSlice(s.Nodes.SameHost, func(i string) (bool, string) {
 		return true, i //nolint:forcetypeassert //...
 	}) {
@@ -45,6 +78,150 @@ func (s Design) IsValid(b []byte) error {
 	return nil
 }
 
+// DesignMatrix is the values of vars for sweep; the scenario runs once per
+// combination of values.
+type DesignMatrix map[string][]interface{}
+
+func (m DesignMatrix) IsValid([]byte) error {
+	e := util.StringError("invalid DesignMatrix")
+
+	for k := range m {
+		switch {
+		case !strings.HasPrefix(k, "."):
+			return e.Errorf("wrong key format; must start with `.`, %q", k)
+		case len(m[k]) < 1:
+			return e.Errorf("empty values, %q", k)
+		}
+	}
+
+	return nil
+}
+
+// Keys returns the sorted keys.
+func (m DesignMatrix) Keys() []string {
+	keys := make([]string, len(m))
+
+	var i int
+
+	for k := range m {
+		keys[i] = k
+		i++
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Combinations returns the cartesian product of values; the values of the last
+// key change first.
+func (m DesignMatrix) Combinations() []map[string]interface{} {
+	if len(m) < 1 {
+		return nil
+	}
+
+	keys := m.Keys()
+
+	combs := []map[string]interface{}{{}}
+
+	for i := range keys {
+		k := keys[i]
+
+		ncombs := make([]map[string]interface{}, 0, len(combs)*len(m[k]))
+
+		for j := range combs {
+			for l := range m[k] {
+				c := map[string]interface{}{}
+
+				for n := range combs[j] {
+					c[n] = combs[j][n]
+				}
+
+				c[k] = m[k][l]
+
+				ncombs = append(ncombs, c)
+			}
+		}
+
+		combs = ncombs
+	}
+
+	return combs
+}
+
+// DesignIndex is the additional index of log entries for the fields, which the
+// conditions of scenario filter on, like `x.round`. The key with `-` prefix is
+// descending.
+type DesignIndex struct {
+	Name string   `yaml:"name"`
+	Keys []string `yaml:"keys"`
+}
+
+func (d DesignIndex) IsValid([]byte) error {
+	e := util.StringError("invalid DesignIndex")
+
+	if len(d.Keys) < 1 {
+		return e.Errorf("empty keys")
+	}
+
+	for i := range d.Keys {
+		switch k := strings.TrimPrefix(d.Keys[i], "-"); {
+		case len(k) < 1:
+			return e.Errorf("empty key")
+		case strings.HasPrefix(k, "$"):
+			return e.Errorf("wrong key; must not start with `$`, %q", k)
+		}
+	}
+
+	if util.IsDuplicatedSlice(d.Keys, func(i string) (bool, string) {
+		return true, strings.TrimPrefix(i, "-")
+	}) {
+		return e.Errorf("duplicated keys found")
+	}
+
+	return nil
+}
+
+// IndexName returns the name of index; without name, it is made from the keys.
+func (d DesignIndex) IndexName() string {
+	if len(d.Name) > 0 {
+		return d.Name
+	}
+
+	names := make([]string, len(d.Keys))
+
+	for i := range d.Keys {
+		k := d.Keys[i]
+
+		switch {
+		case strings.HasPrefix(k, "-"):
+			names[i] = strings.ReplaceAll(k[1:], ".", "_") + "_desc"
+		default:
+			names[i] = strings.ReplaceAll(k, ".", "_")
+		}
+	}
+
+	return mongodbIndexPrefix + "_design_" + strings.Join(names, "_")
+}
+
+func (d DesignIndex) IndexModel() mongo.IndexModel {
+	keys := make(bson.D, len(d.Keys))
+
+	for i := range d.Keys {
+		switch k := d.Keys[i]; {
+		case strings.HasPrefix(k, "-"):
+			keys[i] = bson.E{Key: k[1:], Value: -1}
+		default:
+			keys[i] = bson.E{Key: k, Value: 1}
+		}
+	}
+
+	return mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetName(d.IndexName()),
+	}
+}
+
 type NodeDesigns struct {
 	Common      string            `yaml:"common"`
 	NumberNodes *int              `yaml:"number_nodes"`
@@ -145,11 +322,40 @@ type ExpectScenario struct {
 	Registers         []ScenarioRegister    `yaml:"registers"`
 	Interval          time.Duration         `yaml:"interval"`
 	InitialWait       time.Duration         `yaml:"initial_wait"`
+	Parallel          *ExpectParallel       `yaml:"parallel"`
+	Repeat            *ExpectRepeat         `yaml:"repeat"`
+	// Timeout limits the time to wait for the condition. When it expires,
+	// OnTimeout actions are run and the next expect continues; without
+	// OnTimeout, contest fails. For absent and never, it ends the window and
+	// the condition is matched.
+	Timeout   time.Duration    `yaml:"timeout"`
+	OnTimeout []ScenarioAction `yaml:"on_timeout"`
+	// Label names the expect; it is the target of goto in the same expects.
+	Label string `yaml:"label"`
+	// OnMatch is applied after the condition is matched and actions are done.
+	OnMatch *ExpectFlow `yaml:"on_match"`
+	// OnFail is applied when the condition is not matched; with Timeout, it
+	// is applied when the timeout expires. Without Timeout, it is the
+	// immediate if check; it is applied when the first evaluation is not
+	// matched. For absent and never, it is applied when the query is matched.
+	OnFail *ExpectFlow `yaml:"on_fail"`
 }
 
 func (s ExpectScenario) IsValid(b []byte) error {
 	e := util.StringError("invalid ExpectScenario")
 
+	if err := s.isValidFlow(b); err != nil {
+		return e.Wrap(err)
+	}
+
+	if s.IsBlock() {
+		if err := s.isValidBlock(b); err != nil {
+			return e.Wrap(err)
+		}
+
+		return nil
+	}
+
 	if s.Log != "" {
 		return nil
 	}
@@ -182,10 +388,19 @@ func (s ExpectScenario) IsValid(b []byte) error {
 		return e.Errorf("under zero initial_wait")
 	}
 
+	if err := s.isValidTimeout(b); err != nil {
+		return e.Wrap(err)
+	}
+
 	if err := s.IfConditionFailed.IsValid(nil); err != nil {
 		return e.Wrap(err)
 	}
 
+	if s.IfConditionFailed != IfConditionFailedNothing && s.isAbsent() {
+		// NOTE absent and never are not matched until the window ends.
+		return e.Errorf("if_condition_failed of absent or never; use on_fail")
+	}
+
 	return nil
 }
 
@@ -228,8 +443,16 @@ func (s ExpectScenario) Compile(vars *Vars) (newexpect ExpectScenario, err error
 	newexpect.Interval = s.Interval
 	newexpect.InitialWait = s.InitialWait
 	newexpect.IfConditionFailed = s.IfConditionFailed
+	newexpect.Parallel = s.Parallel
+	newexpect.Repeat = s.Repeat
+	newexpect.Timeout = s.Timeout
+	newexpect.Label = s.Label
+	newexpect.OnMatch = s.OnMatch
+	newexpect.OnFail = s.OnFail
+	newexpect.OnTimeout = make([]ScenarioAction, len(s.OnTimeout))
 
 	copy(newexpect.Actions, s.Actions)
+	copy(newexpect.OnTimeout, s.OnTimeout)
 
 	newexpect.Registers = make([]ScenarioRegister, len(s.Registers))
 	for i := range s.Registers {
@@ -269,6 +492,130 @@ func (s ExpectScenario) Compile(vars *Vars) (newexpect ExpectScenario, err error
 	return newexpect, nil
 }
 
+// IsBlock returns true if the expect has nested expects, parallel or repeat.
+func (s ExpectScenario) IsBlock() bool {
+	return s.Parallel != nil || s.Repeat != nil
+}
+
+func (s ExpectScenario) isValidBlock(b []byte) error {
+	switch {
+	case s.Parallel != nil && s.Repeat != nil:
+		return errors.Errorf("parallel and repeat can not be used together")
+	case s.Condition != nil:
+		return errors.Errorf("parallel or repeat expect can not have condition")
+	case len(s.Range) > 0, len(s.Actions) > 0, len(s.Registers) > 0:
+		return errors.Errorf("parallel or repeat expect can not have range, actions or registers")
+	}
+
+	if s.Parallel != nil {
+		if err := s.Parallel.IsValid(b); err != nil {
+			return err
+		}
+	}
+
+	if s.Repeat != nil {
+		if err := s.Repeat.IsValid(b); err != nil {
+			return err
+		}
+	}
+
+	return s.isValidTimeout(b)
+}
+
+func (s ExpectScenario) isValidFlow(b []byte) error {
+	if s.OnMatch != nil {
+		if s.OnMatch.Skip {
+			return errors.Errorf("skip is not allowed in on_match")
+		}
+
+		if err := s.OnMatch.IsValid(b); err != nil {
+			return errors.WithMessage(err, "on_match")
+		}
+	}
+
+	if s.OnFail != nil {
+		if err := s.OnFail.IsValid(b); err != nil {
+			return errors.WithMessage(err, "on_fail")
+		}
+	}
+
+	if s.IsBlock() && s.OnFail != nil && s.Timeout < 1 {
+		return errors.Errorf("on_fail of parallel or repeat expect needs timeout")
+	}
+
+	if s.isNever() {
+		for _, flow := range []*ExpectFlow{s.OnMatch, s.OnFail} {
+			if flow != nil && len(flow.Goto) > 0 {
+				return errors.Errorf("never expect runs in background; goto is not allowed")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s ExpectScenario) isValidTimeout(b []byte) error {
+	if s.Timeout < 0 {
+		return errors.Errorf("under zero timeout")
+	}
+
+	if len(s.OnTimeout) > 0 && s.Timeout < 1 {
+		return errors.Errorf("on_timeout without timeout")
+	}
+
+	if len(s.OnTimeout) > 0 && s.isAbsent() {
+		return errors.Errorf("on_timeout of absent or never; timeout ends the window")
+	}
+
+	for i := range s.OnTimeout {
+		if err := s.OnTimeout[i].IsValid(b); err != nil {
+			return errors.WithMessage(err, "on_timeout")
+		}
+	}
+
+	return nil
+}
+
+// ConditionString returns the condition text for logs and errors.
+func (s ExpectScenario) ConditionString() string {
+	switch t := s.Condition.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(t)
+	default:
+		b, _ := util.MarshalJSON(t)
+
+		return string(b)
+	}
+}
+
+// isAbsent returns true if the condition is absent or never.
+func (s ExpectScenario) isAbsent() bool {
+	m, ok := s.Condition.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	_, isabsent := m["absent"]
+	_, isnever := m["never"]
+
+	return isabsent || isnever
+}
+
+// isNever returns true if the condition is never; the never expect watches in
+// background until the enclosing expects are finished.
+func (s ExpectScenario) isNever() bool {
+	m, ok := s.Condition.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	_, found := m["never"]
+
+	return found
+}
+
 func (s ExpectScenario) isValidCondition() error {
 	switch s.Condition.(type) {
 	case string:
@@ -280,6 +627,253 @@ func (s ExpectScenario) isValidCondition() error {
 	return nil
 }
 
+// ExpectFlow changes the order of expects. Actions are run first, and then it
+// jumps to the expect labeled by Goto. Without Goto, the next expect follows.
+// In YAML, "skip" can be used instead of an empty flow.
+type ExpectFlow struct {
+	Goto    string           `yaml:"goto"`
+	Actions []ScenarioAction `yaml:"actions"`
+	Skip    bool             `yaml:"skip"`
+}
+
+func (s ExpectFlow) IsValid(b []byte) error {
+	e := util.StringError("invalid ExpectFlow")
+
+	if s.Skip && len(s.Goto) > 0 {
+		return e.Errorf("skip and goto can not be used together")
+	}
+
+	for i := range s.Actions {
+		if err := s.Actions[i].IsValid(b); err != nil {
+			return e.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *ExpectFlow) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		if n.Value != "skip" {
+			return errors.Errorf("unknown flow, %q", n.Value)
+		}
+
+		s.Skip = true
+
+		return nil
+	}
+
+	type flow ExpectFlow
+
+	var u flow
+
+	if err := n.Decode(&u); err != nil {
+		return errors.WithStack(err)
+	}
+
+	*s = ExpectFlow(u)
+
+	return nil
+}
+
+// isValidExpectsFlow checks the labels and goto targets of expects; goto can
+// jump only to the labeled expect in the same expects.
+func isValidExpectsFlow(expects []ExpectScenario) error {
+	labels := map[string]struct{}{}
+
+	for i := range expects {
+		label := expects[i].Label
+
+		if len(label) < 1 {
+			continue
+		}
+
+		if _, found := labels[label]; found {
+			return errors.Errorf("duplicated label, %q", label)
+		}
+
+		labels[label] = struct{}{}
+	}
+
+	for i := range expects {
+		for _, flow := range []*ExpectFlow{expects[i].OnMatch, expects[i].OnFail} {
+			if flow == nil || len(flow.Goto) < 1 {
+				continue
+			}
+
+			if _, found := labels[flow.Goto]; !found {
+				return errors.Errorf("goto label not found, %q", flow.Goto)
+			}
+		}
+	}
+
+	return nil
+}
+
+type ExpectJoinType string
+
+var (
+	ExpectJoinAll ExpectJoinType = "all"
+	ExpectJoinAny ExpectJoinType = "any"
+)
+
+func (i ExpectJoinType) IsValid([]byte) error {
+	switch i {
+	case "", ExpectJoinAll, ExpectJoinAny:
+		return nil
+	default:
+		return errors.Errorf("unknown join type, %q", i)
+	}
+}
+
+// ExpectParallel evaluates the expects of each track at the same time. With
+// join "all"(default), it is finished when every track is finished; with join
+// "any", it is finished when one of the tracks is finished and the other tracks
+// are canceled.
+type ExpectParallel struct {
+	Join   ExpectJoinType `yaml:"join"`
+	Tracks []ExpectTrack  `yaml:"tracks"`
+}
+
+func (s ExpectParallel) IsValid(b []byte) error {
+	e := util.StringError("invalid ExpectParallel")
+
+	if err := s.Join.IsValid(nil); err != nil {
+		return e.Wrap(err)
+	}
+
+	if len(s.Tracks) < 1 {
+		return e.Errorf("empty tracks")
+	}
+
+	names := map[string]struct{}{}
+
+	for i := range s.Tracks {
+		track := s.Tracks[i]
+
+		if err := track.IsValid(b); err != nil {
+			return e.WithMessage(err, "track %d", i)
+		}
+
+		if len(track.Name) < 1 {
+			continue
+		}
+
+		if _, found := names[track.Name]; found {
+			return e.Errorf("duplicated track name, %q", track.Name)
+		}
+
+		names[track.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+type ExpectTrack struct {
+	Name    string           `yaml:"name"`
+	Expects []ExpectScenario `yaml:"expects"`
+}
+
+func (s ExpectTrack) TrackName(index int) string {
+	if len(s.Name) > 0 {
+		return s.Name
+	}
+
+	return fmt.Sprintf("%d", index)
+}
+
+func (s ExpectTrack) IsValid(b []byte) error {
+	e := util.StringError("invalid ExpectTrack")
+
+	if len(s.Expects) < 1 {
+		return e.Errorf("empty expects")
+	}
+
+	for i := range s.Expects {
+		if err := s.Expects[i].IsValid(b); err != nil {
+			return e.Wrap(err)
+		}
+	}
+
+	if err := isValidExpectsFlow(s.Expects); err != nil {
+		return e.Wrap(err)
+	}
+
+	return nil
+}
+
+// Invariant is checked during the whole contest run. The condition describes
+// the violation; when it is matched, contest is stopped.
+type Invariant struct {
+	Name      string                `yaml:"name"`
+	Condition interface{}           `yaml:"condition"`
+	Range     []map[string][]string `yaml:"range"`
+	Interval  time.Duration         `yaml:"interval"`
+}
+
+func (s Invariant) IsValid([]byte) error {
+	e := util.StringError("invalid Invariant")
+
+	if s.Condition == nil {
+		return e.Errorf("empty condition")
+	}
+
+	if err := s.expect().isValidCondition(); err != nil {
+		return e.Wrap(err)
+	}
+
+	if s.Interval < 0 {
+		return e.Errorf("under zero interval")
+	}
+
+	return nil
+}
+
+func (s Invariant) expect() ExpectScenario {
+	return ExpectScenario{Condition: s.Condition, Range: s.Range}
+}
+
+// ExpectRepeat runs the expects Count times or until the Until condition is
+// matched; Until is checked after each iteration. With Until, zero Count means
+// no limit. The iteration index is set to `.loop.index` of vars; it is seen
+// only by the nested expects and Until.
+type ExpectRepeat struct {
+	Until   interface{}      `yaml:"until"`
+	Expects []ExpectScenario `yaml:"expects"`
+	Count   int              `yaml:"count"`
+}
+
+func (s ExpectRepeat) IsValid(b []byte) error {
+	e := util.StringError("invalid ExpectRepeat")
+
+	switch {
+	case s.Count < 0:
+		return e.Errorf("under zero count")
+	case s.Count < 1 && s.Until == nil:
+		return e.Errorf("empty count and until")
+	case len(s.Expects) < 1:
+		return e.Errorf("empty expects")
+	}
+
+	if s.Until != nil {
+		if err := (ExpectScenario{Condition: s.Until}).isValidCondition(); err != nil {
+			return e.WithMessage(err, "until")
+		}
+	}
+
+	if err := isValidExpectsFlow(s.Expects); err != nil {
+		return e.Wrap(err)
+	}
+
+	for i := range s.Expects {
+		if err := s.Expects[i].IsValid(b); err != nil {
+			return e.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
 type ScenarioAction struct {
 	Type       string                 `yaml:"type"`
 	Properties map[string]interface{} `yaml:"properties"`
@@ -0,0 +1,484 @@
+package contest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spikeekips/mitum/util"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadDesignFile loads scenario file and resolves the directives for
+// composing scenarios from shared fragments.
+//
+//   - extends: file or files; the scenario is merged over them in order. Maps
+//     are merged recursively and the other values, including lists, are
+//     replaced.
+//   - include: in expects, `- include: <file>` is replaced by the expects of
+//     file; file can be list of expects or map with `expects`.
+//   - templates: named expects; `- template: <name>` in expects is replaced by
+//     the named expect and the other keys override it.
+//
+// The file paths are relative to the file, which has the directive. vars
+// override the vars of scenario in order. `designs.number_nodes` can be
+// template string with vars. It returns the merged scenario.
+func LoadDesignFile(f string, vars ...map[string]interface{}) (design Design, merged []byte, _ error) {
+	e := util.StringError("load design file")
+
+	m, err := loadDesignMap(f, nil)
+	if err != nil {
+		return design, nil, e.Wrap(err)
+	}
+
+	if err := mergeDesignVars(m, vars...); err != nil {
+		return design, nil, e.Wrap(err)
+	}
+
+	if err := compileDesignNumberNodes(m); err != nil {
+		return design, nil, e.Wrap(err)
+	}
+
+	templates := map[string]interface{}{}
+
+	if i, found := m["templates"]; found {
+		j, ok := i.(map[string]interface{})
+		if !ok {
+			return design, nil, e.Errorf("templates should be map, not %T", i)
+		}
+
+		templates = j
+	}
+
+	delete(m, "templates")
+
+	if i, found := m["expects"]; found {
+		j, err := resolveDesignExpects(i, func(expect map[string]interface{}) ([]interface{}, error) {
+			k, err := resolveExpectTemplate(expect, templates, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			return []interface{}{k}, nil
+		})
+		if err != nil {
+			return design, nil, e.Wrap(err)
+		}
+
+		m["expects"] = j
+	}
+
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return design, nil, e.Wrap(err)
+	}
+
+	if err := yaml.Unmarshal(b, &design); err != nil {
+		return design, nil, e.Wrap(err)
+	}
+
+	return design, b, nil
+}
+
+// LoadDesignMatrix loads the matrix of scenario file; extends are resolved, but
+// vars are not compiled.
+func LoadDesignMatrix(f string) (DesignMatrix, error) {
+	e := util.StringError("load design matrix")
+
+	m, err := loadDesignMap(f, nil)
+	if err != nil {
+		return nil, e.Wrap(err)
+	}
+
+	b, err := yaml.Marshal(map[string]interface{}{"matrix": m["matrix"]})
+	if err != nil {
+		return nil, e.Wrap(err)
+	}
+
+	var design Design
+
+	if err := yaml.Unmarshal(b, &design); err != nil {
+		return nil, e.Wrap(err)
+	}
+
+	return design.Matrix, nil
+}
+
+func loadDesignMap(f string, loaded []string) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(f)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for i := range loaded {
+		if loaded[i] == abs {
+			return nil, errors.Errorf("circular extends, %q", f)
+		}
+	}
+
+	b, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var m map[string]interface{}
+
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, errors.WithMessagef(err, "file, %q", f)
+	}
+
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+
+	dir := filepath.Dir(abs)
+
+	if i, found := m["expects"]; found {
+		j, err := resolveDesignExpects(i, func(expect map[string]interface{}) ([]interface{}, error) {
+			return resolveExpectInclude(expect, dir, []string{abs})
+		})
+		if err != nil {
+			return nil, errors.WithMessagef(err, "file, %q", f)
+		}
+
+		m["expects"] = j
+	}
+
+	i, found := m["extends"]
+	if !found {
+		return m, nil
+	}
+
+	delete(m, "extends")
+
+	var parents []string
+
+	switch t := i.(type) {
+	case string:
+		parents = []string{t}
+	case []interface{}:
+		for j := range t {
+			s, ok := t[j].(string)
+			if !ok {
+				return nil, errors.Errorf("extends should be file, not %T", t[j])
+			}
+
+			parents = append(parents, s)
+		}
+	default:
+		return nil, errors.Errorf("extends should be file or files, not %T", i)
+	}
+
+	base := map[string]interface{}{}
+
+	for j := range parents {
+		p := parents[j]
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+
+		pm, err := loadDesignMap(p, append(loaded, abs)) //nolint:gocritic //...
+		if err != nil {
+			return nil, err
+		}
+
+		mergeDesignMap(base, pm)
+	}
+
+	mergeDesignMap(base, m)
+
+	return base, nil
+}
+
+// resolveExpectInclude replaces the include with the expects of file; included
+// has the files, which are already included in the chain.
+func resolveExpectInclude(expect map[string]interface{}, dir string, included []string) ([]interface{}, error) {
+	i, found := expect["include"]
+	if !found {
+		return []interface{}{expect}, nil
+	}
+
+	f, ok := i.(string)
+	if !ok {
+		return nil, errors.Errorf("include should be file, not %T", i)
+	}
+
+	if len(expect) > 1 {
+		return nil, errors.Errorf("include can not have other keys, %q", f)
+	}
+
+	if !filepath.IsAbs(f) {
+		f = filepath.Join(dir, f)
+	}
+
+	f = filepath.Clean(f)
+
+	for j := range included {
+		if included[j] == f {
+			return nil, errors.Errorf("circular include, %q", f)
+		}
+	}
+
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var u interface{}
+
+	if err := yaml.Unmarshal(b, &u); err != nil {
+		return nil, errors.WithMessagef(err, "include, %q", f)
+	}
+
+	if m, ok := u.(map[string]interface{}); ok {
+		u = m["expects"]
+	}
+
+	expects, ok := u.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("include should have expects, %q", f)
+	}
+
+	return resolveDesignExpects(expects, func(expect map[string]interface{}) ([]interface{}, error) {
+		return resolveExpectInclude(expect, filepath.Dir(f), append(included, f)) //nolint:gocritic //...
+	})
+}
+
+func resolveExpectTemplate(
+	expect map[string]interface{}, templates map[string]interface{}, resolved []string,
+) (map[string]interface{}, error) {
+	i, found := expect["template"]
+	if !found {
+		return expect, nil
+	}
+
+	name, ok := i.(string)
+	if !ok {
+		return nil, errors.Errorf("template should be name, not %T", i)
+	}
+
+	for j := range resolved {
+		if resolved[j] == name {
+			return nil, errors.Errorf("circular template, %q", name)
+		}
+	}
+
+	j, found := templates[name]
+	if !found {
+		return nil, errors.Errorf("template not found, %q", name)
+	}
+
+	t, ok := j.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("template should be map, not %T", j)
+	}
+
+	base := copyValue(reflect.ValueOf(t)).Interface().(map[string]interface{}) //nolint:forcetypeassert //...
+
+	base, err := resolveExpectTemplate(base, templates, append(resolved, name)) //nolint:gocritic //...
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+
+	for k := range expect {
+		if k != "template" {
+			m[k] = expect[k]
+		}
+	}
+
+	mergeDesignMap(base, m)
+
+	return base, nil
+}
+
+// resolveDesignExpects replaces each expect with the result of f; the nested
+// expects of parallel tracks and repeat are also resolved.
+func resolveDesignExpects(
+	i interface{},
+	f func(map[string]interface{}) ([]interface{}, error),
+) ([]interface{}, error) {
+	if i == nil {
+		return nil, nil
+	}
+
+	l, ok := i.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("expects should be list, not %T", i)
+	}
+
+	var expects []interface{}
+
+	for j := range l {
+		m, ok := l[j].(map[string]interface{})
+		if !ok {
+			expects = append(expects, l[j])
+
+			continue
+		}
+
+		r, err := f(m)
+		if err != nil {
+			return nil, err
+		}
+
+		for k := range r {
+			if err := resolveNestedDesignExpects(r[k], f); err != nil {
+				return nil, err
+			}
+		}
+
+		expects = append(expects, r...)
+	}
+
+	return expects, nil
+}
+
+func resolveNestedDesignExpects(
+	i interface{},
+	f func(map[string]interface{}) ([]interface{}, error),
+) error {
+	expect, ok := i.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if p, ok := expect["parallel"].(map[string]interface{}); ok {
+		tracks, _ := p["tracks"].([]interface{})
+
+		for j := range tracks {
+			track, ok := tracks[j].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			l, err := resolveDesignExpects(track["expects"], f)
+			if err != nil {
+				return err
+			}
+
+			track["expects"] = l
+		}
+	}
+
+	if r, ok := expect["repeat"].(map[string]interface{}); ok {
+		l, err := resolveDesignExpects(r["expects"], f)
+		if err != nil {
+			return err
+		}
+
+		r["expects"] = l
+	}
+
+	return nil
+}
+
+// mergeDesignMap merges b into a; maps are merged recursively and the other
+// values are replaced.
+func mergeDesignMap(a, b map[string]interface{}) {
+	for k := range b {
+		bm, isbmap := b[k].(map[string]interface{})
+		am, isamap := a[k].(map[string]interface{})
+
+		if isbmap && isamap {
+			mergeDesignMap(am, bm)
+
+			continue
+		}
+
+		a[k] = b[k]
+	}
+}
+
+// NewDesignVars creates new Vars from the vars of scenario; the keys are set
+// in order, so the nested key, like `.a.b` overrides `.a`.
+func NewDesignVars(m map[string]interface{}) *Vars {
+	keys := make([]string, len(m))
+
+	var i int
+
+	for k := range m {
+		keys[i] = k
+		i++
+	}
+
+	sort.Strings(keys)
+
+	vars := NewVars(nil)
+
+	for i := range keys {
+		vars.Set(keys[i], m[keys[i]])
+	}
+
+	return vars
+}
+
+func mergeDesignVars(m map[string]interface{}, vars ...map[string]interface{}) error {
+	if len(vars) < 1 {
+		return nil
+	}
+
+	dv := map[string]interface{}{}
+
+	if i, found := m["vars"]; found && i != nil {
+		j, ok := i.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("vars should be map, not %T", i)
+		}
+
+		dv = j
+	}
+
+	for i := range vars {
+		for k := range vars[i] {
+			if !strings.HasPrefix(k, ".") {
+				return errors.Errorf("wrong var key format; must start with `.`, %q", k)
+			}
+
+			for j := range dv {
+				if strings.HasPrefix(j, k+".") {
+					delete(dv, j)
+				}
+			}
+
+			dv[k] = vars[i][k]
+		}
+	}
+
+	m["vars"] = dv
+
+	return nil
+}
+
+func compileDesignNumberNodes(m map[string]interface{}) error {
+	designs, ok := m["designs"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	s, ok := designs["number_nodes"].(string)
+	if !ok {
+		return nil
+	}
+
+	dv, _ := m["vars"].(map[string]interface{})
+
+	i, err := CompileTemplate(s, NewDesignVars(dv), nil)
+	if err != nil {
+		return errors.WithMessage(err, "number_nodes")
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(i))
+	if err != nil {
+		return errors.WithMessage(err, "number_nodes")
+	}
+
+	designs["number_nodes"] = n
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package contest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type testLoadDesignFile struct {
+	suite.Suite
+	dir string
+}
+
+func (t *testLoadDesignFile) SetupTest() {
+	t.dir = t.T().TempDir()
+}
+
+func (t *testLoadDesignFile) write(name, s string) string {
+	f := filepath.Join(t.dir, name)
+
+	t.NoError(os.MkdirAll(filepath.Dir(f), 0o700))
+	t.NoError(os.WriteFile(f, []byte(s), 0o600))
+
+	return f
+}
+
+func (t *testLoadDesignFile) TestExtendsAndInclude() {
+	t.write("base.yml", `
+vars:
+  .network_id: base
+  .threshold: 67
+designs:
+  common: |
+    network_id: {{ .network_id }}
+templates:
+  wait-ready:
+    condition: '{"x.message": "ready"}'
+    interval: 1s
+expects:
+  - condition: '{"x.message": "base"}'
+`)
+
+	t.write("fragments/sync.yml", `
+- condition: '{"x.message": "synced"}'
+- include: more.yml
+`)
+
+	t.write("fragments/more.yml", `
+expects:
+  - condition: '{"x.message": "more"}'
+`)
+
+	f := t.write("child.yml", `
+extends: base.yml
+vars:
+  .network_id: child
+expects:
+  - template: wait-ready
+    interval: 2s
+  - include: fragments/sync.yml
+  - parallel:
+      tracks:
+        - expects:
+            - template: wait-ready
+`)
+
+	design, _, err := LoadDesignFile(f)
+	t.NoError(err)
+
+	t.Equal("child", design.Vars[".network_id"])
+	t.Equal(67, design.Vars[".threshold"])
+	t.Contains(design.Designs.Common, "network_id")
+
+	t.Equal(4, len(design.Expects))
+	t.Equal(`{"x.message": "ready"}`, design.Expects[0].Condition)
+	t.Equal("2s", design.Expects[0].Interval.String())
+	t.Equal(`{"x.message": "synced"}`, design.Expects[1].Condition)
+	t.Equal(`{"x.message": "more"}`, design.Expects[2].Condition)
+	t.NotNil(design.Expects[3].Parallel)
+	t.Equal(`{"x.message": "ready"}`, design.Expects[3].Parallel.Tracks[0].Expects[0].Condition)
+}
+
+func (t *testLoadDesignFile) TestVars() {
+	f := t.write("a.yml", `
+vars:
+  .threshold: 67
+  .number_nodes: 3
+  .timing:
+    interval: 1s
+    wait: 2s
+designs:
+  number_nodes: "{{ .number_nodes }}"
+expects:
+  - condition: '{"x.message": "ready"}'
+`)
+
+	design, _, err := LoadDesignFile(f,
+		map[string]interface{}{".number_nodes": 4, ".timing.wait": "3s"},
+		map[string]interface{}{".number_nodes": 5},
+	)
+	t.NoError(err)
+
+	t.Equal(5, *design.Designs.NumberNodes)
+	t.Equal(5, len(design.Designs.AllNodes()))
+
+	vars := NewDesignVars(design.Vars)
+
+	i, _ := vars.Value(".threshold")
+	t.Equal(67, i)
+
+	i, _ = vars.Value(".timing.interval")
+	t.Equal("1s", i)
+
+	i, _ = vars.Value(".timing.wait")
+	t.Equal("3s", i)
+
+	t.Run("wrong key", func() {
+		_, _, err := LoadDesignFile(f, map[string]interface{}{"threshold": 1})
+		t.Error(err)
+		t.ErrorContains(err, "wrong var key format")
+	})
+}
+
+func (t *testLoadDesignFile) TestUnknownTemplate() {
+	f := t.write("a.yml", `
+expects:
+  - template: unknown
+`)
+
+	_, _, err := LoadDesignFile(f)
+	t.Error(err)
+	t.ErrorContains(err, "template not found")
+}
+
+func (t *testLoadDesignFile) TestCircularExtends() {
+	t.write("a.yml", `extends: b.yml`)
+	f := t.write("b.yml", `extends: a.yml`)
+
+	_, _, err := LoadDesignFile(f)
+	t.Error(err)
+	t.ErrorContains(err, "circular extends")
+}
+
+func (t *testLoadDesignFile) TestCircularInclude() {
+	t.write("a.yml", `
+expects:
+  - include: b.yml
+`)
+	t.write("b.yml", `
+- include: a.yml
+`)
+	f := t.write("c.yml", `
+expects:
+  - include: a.yml
+`)
+
+	_, _, err := LoadDesignFile(f)
+	t.Error(err)
+	t.ErrorContains(err, "circular include")
+
+	t.Run("self", func() {
+		f := t.write("d.yml", `
+expects:
+  - include: d.yml
+`)
+
+		_, _, err := LoadDesignFile(f)
+		t.Error(err)
+		t.ErrorContains(err, "circular include")
+	})
+}
+
+func TestLoadDesignFile(t *testing.T) {
+	suite.Run(t, new(testLoadDesignFile))
+}
@@ -0,0 +1,88 @@
+package contest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type testDesignMatrix struct {
+	suite.Suite
+}
+
+func (t *testDesignMatrix) TestCombinations() {
+	m := DesignMatrix{
+		".threshold":    {67, 100},
+		".number_nodes": {3, 4, 5},
+	}
+
+	t.NoError(m.IsValid(nil))
+
+	combs := m.Combinations()
+	t.Equal(6, len(combs))
+
+	t.Equal(map[string]interface{}{".number_nodes": 3, ".threshold": 67}, combs[0])
+	t.Equal(map[string]interface{}{".number_nodes": 3, ".threshold": 100}, combs[1])
+	t.Equal(map[string]interface{}{".number_nodes": 5, ".threshold": 100}, combs[5])
+}
+
+func (t *testDesignMatrix) TestInvalid() {
+	t.Run("wrong key", func() {
+		err := DesignMatrix{"threshold": {67}}.IsValid(nil)
+		t.Error(err)
+		t.ErrorContains(err, "wrong key format")
+	})
+
+	t.Run("empty values", func() {
+		err := DesignMatrix{".threshold": {}}.IsValid(nil)
+		t.Error(err)
+		t.ErrorContains(err, "empty values")
+	})
+}
+
+func TestDesignMatrix(t *testing.T) {
+	suite.Run(t, new(testDesignMatrix))
+}
+
+type testDesignIndex struct {
+	suite.Suite
+}
+
+func (t *testDesignIndex) TestIndexModel() {
+	d := DesignIndex{Keys: []string{"x.round", "-x.height"}}
+	t.NoError(d.IsValid(nil))
+
+	t.Equal("contest_log_design_x_round_x_height_desc", d.IndexName())
+
+	m := d.IndexModel()
+	t.Equal(bson.D{{Key: "x.round", Value: 1}, {Key: "x.height", Value: -1}}, m.Keys)
+	t.Equal(d.IndexName(), *m.Options.Name)
+
+	d.Name = "round"
+	t.Equal("round", *d.IndexModel().Options.Name)
+}
+
+func (t *testDesignIndex) TestInvalid() {
+	t.Run("empty keys", func() {
+		err := DesignIndex{}.IsValid(nil)
+		t.Error(err)
+		t.ErrorContains(err, "empty keys")
+	})
+
+	t.Run("operator key", func() {
+		err := DesignIndex{Keys: []string{"$x"}}.IsValid(nil)
+		t.Error(err)
+		t.ErrorContains(err, "must not start with")
+	})
+
+	t.Run("duplicated keys", func() {
+		err := DesignIndex{Keys: []string{"x.height", "-x.height"}}.IsValid(nil)
+		t.Error(err)
+		t.ErrorContains(err, "duplicated keys")
+	})
+}
+
+func TestDesignIndex(t *testing.T) {
+	suite.Run(t, new(testDesignIndex))
+}
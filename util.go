@@ -3,10 +3,18 @@ package contest
 import (
 	"bytes"
 	"fmt"
+	"regexp"
 
 	"github.com/spikeekips/mitum/util"
 )
 
+var reULID = regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+
+// IsULID checks whether the string is ulid, like the _id of log entry.
+func IsULID(s string) bool {
+	return reULID.MatchString(s)
+}
+
 type BuildInfo struct {
 	util.BuildInfo
 	MitumBranch  string